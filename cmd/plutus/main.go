@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"os/signal"
 	"syscall"
 
@@ -16,10 +17,16 @@ func main() {
 	log := logrus.New()
 	log.SetReportCaller(true)
 
+	configFile := flag.String("config", "", "path of the config file, config.yaml or conf/config.yaml if not set")
+	flag.Parse()
+	app.SetConfigFile(*configFile)
+
+	if err := app.ValidateConfig(); err != nil {
+		log.Fatalf("invalid config:\n%s", err)
+	}
 	var config app.Config
 	if err := app.LoadConfig("", &config); err != nil {
-		log.Error(err)
-		return
+		log.Fatal(err)
 	}
 
 	app := app.NewApp(
@@ -3,11 +3,14 @@ package app
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/nanmu42/etherscan-api"
 	log "github.com/sirupsen/logrus"
+
+	"plutus/pkg/notice"
 )
 
 type App struct {
@@ -17,11 +20,16 @@ type App struct {
 	log      *log.Logger
 
 	*Status
+
+	mu sync.Mutex
+	// flattened config, to tell what a reload changes
+	keys map[string]any
 }
 
 type Status struct {
 	Client        Client
 	BscScanClient *etherscan.Client
+	Checkpoint    Checkpoint
 }
 
 func (app *App) runService(ctx context.Context, srv Service) {
@@ -36,12 +44,33 @@ func (app *App) runService(ctx context.Context, srv Service) {
 	}
 }
 
+// dialNode connects to a single node, subscriptions are emulated by polling
+// on http nodes.
+func (app *App) dialNode(ctx context.Context, url string) (Client, error) {
+	client, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if isHTTP(url) {
+		return NewPollingClient(client, app.config.PollInterval, app.config.PollRange), nil
+	}
+	return client, nil
+}
+
+func (app *App) dial(ctx context.Context) (Client, error) {
+	endpoints := app.config.Endpoints()
+	if len(endpoints) == 1 {
+		return app.dialNode(ctx, endpoints[0])
+	}
+	return DialMultiClient(ctx, endpoints, app.dialNode)
+}
+
 func (app *App) Run(ctx context.Context) error {
 	log := app.log.
 		WithField("service", app.services).
 		WithField("config", app.config)
 
-	client, err := ethclient.Dial(app.config.NodeAddress)
+	client, err := app.dial(ctx)
 	if err != nil {
 		return fmt.Errorf("connect to Node failed: %w", err)
 	}
@@ -52,6 +81,17 @@ func (app *App) Run(ctx context.Context) error {
 		Key:     app.config.BscScanToken,
 		BaseURL: `https://api.bscscan.com/api?`,
 	})
+	app.Checkpoint = NewMemoryCheckpoint()
+	if app.config.CheckpointFile != "" {
+		checkpoint, err := NewFileCheckpoint(app.config.CheckpointFile)
+		if err != nil {
+			return fmt.Errorf("load checkpoint failed: %w", err)
+		}
+		app.Checkpoint = checkpoint
+	}
+
+	notice.Setup(app.config.NoticeConfig())
+	defer notice.Close()
 
 	for _, s := range app.services {
 		srvLog := app.log.WithField("service", s.Name())
@@ -64,6 +104,20 @@ func (app *App) Run(ctx context.Context) error {
 		go app.runService(ctx, srv)
 	}
 
+	k, err := readConfig()
+	if err != nil {
+		return err
+	}
+	app.mu.Lock()
+	app.keys = k.All()
+	app.mu.Unlock()
+	err = WatchConfig(app.reload, func(err error) {
+		app.log.Warn(err)
+	})
+	if err != nil {
+		app.log.Warnf("config is not reloaded on changes: %s", err)
+	}
+
 	log.Info("App running...")
 	<-ctx.Done()
 
@@ -84,11 +138,11 @@ func NewApp(name string, config *Config, log *log.Logger) *App {
 
 	status := &Status{}
 	app := &App{
-		name,
-		config,
-		srvMap,
-		log,
-		status,
+		name:     name,
+		config:   config,
+		services: srvMap,
+		log:      log,
+		Status:   status,
 	}
 
 	return app
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Checkpoint records the last block each service has fully processed, so a
+// restarted service can replay the blocks it missed.
+type Checkpoint interface {
+	Load(service string) (block uint64, ok bool)
+	Save(service string, block uint64) error
+}
+
+// MemoryCheckpoint keeps checkpoints for the lifetime of the process only. It
+// covers service restarts done by App.runService but not redeployments.
+type MemoryCheckpoint struct {
+	mu     sync.Mutex
+	blocks map[string]uint64
+}
+
+func NewMemoryCheckpoint() *MemoryCheckpoint {
+	return &MemoryCheckpoint{
+		blocks: map[string]uint64{},
+	}
+}
+
+func (c *MemoryCheckpoint) Load(service string) (uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	block, ok := c.blocks[service]
+	return block, ok
+}
+
+func (c *MemoryCheckpoint) Save(service string, block uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if block > c.blocks[service] {
+		c.blocks[service] = block
+	}
+	return nil
+}
+
+// FileCheckpoint persists checkpoints as a JSON object in a file.
+type FileCheckpoint struct {
+	*MemoryCheckpoint
+	path string
+}
+
+func NewFileCheckpoint(path string) (*FileCheckpoint, error) {
+	c := &FileCheckpoint{
+		MemoryCheckpoint: NewMemoryCheckpoint(),
+		path:             path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint failed: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.blocks); err != nil {
+		return nil, fmt.Errorf("parse checkpoint %s failed: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *FileCheckpoint) Save(service string, block uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if block <= c.blocks[service] {
+		return nil
+	}
+	c.blocks[service] = block
+
+	data, err := json.Marshal(c.blocks)
+	if err != nil {
+		return err
+	}
+	// write then rename, so a crash never leaves a truncated file behind
+	tmp := filepath.Join(filepath.Dir(c.path), "."+filepath.Base(c.path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write checkpoint failed: %w", err)
+	}
+	return os.Rename(tmp, c.path)
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestCheckpoint(t *testing.T) {
+	suite.Run(t, new(CheckpointTestSuite))
+}
+
+type CheckpointTestSuite struct {
+	suite.Suite
+
+	path string
+}
+
+func (s *CheckpointTestSuite) SetupTest() {
+	s.path = filepath.Join(s.T().TempDir(), "checkpoint.json")
+}
+
+func (s *CheckpointTestSuite) TestLoadMissingFile() {
+	c, err := NewFileCheckpoint(s.path)
+	s.NoError(err)
+
+	_, ok := c.Load("transfer")
+	s.False(ok)
+}
+
+func (s *CheckpointTestSuite) TestSaveAndReload() {
+	c, err := NewFileCheckpoint(s.path)
+	s.NoError(err)
+	s.NoError(c.Save("transfer", 100))
+	s.NoError(c.Save("constructor", 200))
+	// checkpoints never move backwards
+	s.NoError(c.Save("transfer", 50))
+
+	reloaded, err := NewFileCheckpoint(s.path)
+	s.NoError(err)
+	block, ok := reloaded.Load("transfer")
+	s.True(ok)
+	s.Equal(uint64(100), block)
+	block, ok = reloaded.Load("constructor")
+	s.True(ok)
+	s.Equal(uint64(200), block)
+}
+
+func (s *CheckpointTestSuite) TestMalformedFile() {
+	s.NoError(os.WriteFile(s.path, []byte("not json"), 0o644))
+	_, err := NewFileCheckpoint(s.path)
+	s.Error(err)
+}
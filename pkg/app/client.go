@@ -2,10 +2,14 @@ package app
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
 	"math/big"
+	"math/rand"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
@@ -13,12 +17,24 @@ import (
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/lru"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 const (
 	RetryCnt = 5
+	// RetryBackOff is the wait before the first retry, doubled on every retry
+	RetryBackOff    = 100 * time.Millisecond
+	RetryBackOffMax = 5 * time.Second
+	// FinalityDepth is the number of blocks after which a block is considered
+	// final, lookups at final heights are cached
+	FinalityDepth = 15
 
-	CacheKeyCodeAt = "CodeAt_%s"
+	CacheKeyCodeAt             = "CodeAt_%s_%s"
+	CacheKeyHeaderByNumber     = "HeaderByNumber_%s"
+	CacheKeyBlockByNumber      = "BlockByNumber_%s"
+	CacheKeyTransactionReceipt = "TransactionReceipt_%s"
+	CacheKeyCallContract       = "CallContract_%s_%s"
 )
 
 type Client interface {
@@ -32,9 +48,70 @@ type Client interface {
 	Close()
 }
 
+// ErrRawCallUnsupported is returned by CallContext for clients which can not
+// make raw calls, e.g. replayed ones.
+var ErrRawCallUnsupported = errors.New("raw rpc calls are not supported by the client")
+
+// RPCCaller makes raw JSON-RPC calls, for methods Client has no wrapper of,
+// e.g. of the debug namespace.
+type RPCCaller interface {
+	CallContext(ctx context.Context, result any, method string, args ...any) error
+}
+
+// CallContext makes a raw JSON-RPC call through client, or through the node
+// client it wraps.
+func CallContext(ctx context.Context, client Client, result any, method string, args ...any) error {
+	switch c := client.(type) {
+	case RPCCaller:
+		return c.CallContext(ctx, result, method, args...)
+	case interface{ Client() *rpc.Client }:
+		return c.Client().CallContext(ctx, result, method, args...)
+	}
+	return ErrRawCallUnsupported
+}
+
+// isRetryable reports whether a failed call may succeed when it is repeated,
+// e.g. on transport failures or rate limits, as opposed to legitimate answers
+// such as "not found" or a reverted call.
+func isRetryable(err error) bool {
+	if err == nil ||
+		errors.Is(err, ethereum.NotFound) ||
+		errors.Is(err, ErrRawCallUnsupported) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.ErrorCode() {
+		// server error, internal error and limit exceeded
+		case -32000, -32603, -32005:
+			return true
+		default:
+			return false
+		}
+	}
+	// transport failures
+	return true
+}
+
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// CachedClient retries failed reads and caches immutable lookups.
 type CachedClient struct {
 	Client
-	cache *lru.Cache[string, any]
+	cache  *lru.Cache[string, any]
+	head   atomic.Uint64
+	hits   atomic.Uint64
+	misses atomic.Uint64
 }
 
 func NewCachedClient(baseClient Client, cacheSize int) *CachedClient {
@@ -49,38 +126,160 @@ func (c *CachedClient) Close() {
 	c.cache.Purge()
 }
 
-func (c *CachedClient) retryWithBackOff(maxRetryCnt int, fn func() error) error {
-	var err error
-	for retry := 0; retry <= maxRetryCnt; retry++ {
-		err = fn()
-		if err != nil {
-			sleepTime := math.Pow(2, float64(retry))
-			time.Sleep(time.Duration(sleepTime) * 100 * time.Microsecond)
+func (c *CachedClient) Stats() CacheStats {
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+}
+
+// retryWithBackOff calls fn until it succeeds, fails with an error that is
+// not retryable, maxRetryCnt retries are used up or ctx is done.
+func (c *CachedClient) retryWithBackOff(ctx context.Context, maxRetryCnt int, fn func() error) error {
+	backOff := RetryBackOff
+	for retry := 0; ; retry++ {
+		err := fn()
+		if err == nil || retry >= maxRetryCnt || !isRetryable(err) {
+			return err
+		}
+
+		// randomize the wait, so clients failing at once do not retry at once
+		wait := time.Duration(rand.Int63n(int64(backOff))) + backOff/2
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (last error: %s)", ctx.Err(), err)
+		case <-timer.C:
+		}
+		backOff *= 2
+		if backOff > RetryBackOffMax {
+			backOff = RetryBackOffMax
 		}
 	}
-	return err
 }
 
-func (c *CachedClient) CodeAt(ctx context.Context, contract ethcommon.Address, blockNumber *big.Int) ([]byte, error) {
-	key := fmt.Sprintf(CacheKeyCodeAt, contract)
-	value, ok := c.cache.Get(key)
-	if ok {
-		return value.([]byte), nil
+// final reports whether the block at number can no longer be reorged.
+func (c *CachedClient) final(number *big.Int) bool {
+	head := c.head.Load()
+	return number != nil && number.Sign() >= 0 && number.IsUint64() &&
+		head >= FinalityDepth && number.Uint64() <= head-FinalityDepth
+}
+
+func (c *CachedClient) observeHead(head uint64) {
+	for {
+		old := c.head.Load()
+		if head <= old || c.head.CompareAndSwap(old, head) {
+			return
+		}
 	}
+}
 
-	var code []byte
-	err := c.retryWithBackOff(RetryCnt, func() error {
-		_code, err := c.Client.CodeAt(ctx, contract, blockNumber)
-		if err != nil {
-			return err
+// cachedCall serves fn from the cache under key, or calls it with retries and
+// caches the result if cacheable approves it. An empty key skips the cache.
+func cachedCall[T any](ctx context.Context, c *CachedClient, key string, cacheable func(T) bool, fn func() (T, error)) (T, error) {
+	if key != "" {
+		if value, ok := c.cache.Get(key); ok {
+			c.hits.Add(1)
+			return value.(T), nil
 		}
-		code = _code
-		return nil
+		c.misses.Add(1)
+	}
+
+	var ret T
+	err := c.retryWithBackOff(ctx, RetryCnt, func() error {
+		var err error
+		ret, err = fn()
+		return err
 	})
 	if err != nil {
-		return nil, err
+		return ret, err
+	}
+	if key != "" && cacheable(ret) {
+		c.cache.Add(key, ret)
+	}
+	return ret, nil
+}
+
+func blockKey(number *big.Int) string {
+	if number == nil {
+		return "latest"
+	}
+	return number.String()
+}
+
+func (c *CachedClient) CodeAt(ctx context.Context, contract ethcommon.Address, blockNumber *big.Int) ([]byte, error) {
+	// deployed code never changes, but an address may get code later
+	key := fmt.Sprintf(CacheKeyCodeAt, contract, blockKey(blockNumber))
+	return cachedCall(ctx, c, key, func(code []byte) bool { return len(code) > 0 }, func() ([]byte, error) {
+		return c.Client.CodeAt(ctx, contract, blockNumber)
+	})
+}
+
+func (c *CachedClient) BlockNumber(ctx context.Context) (uint64, error) {
+	head, err := cachedCall(ctx, c, "", nil, func() (uint64, error) {
+		return c.Client.BlockNumber(ctx)
+	})
+	if err == nil {
+		c.observeHead(head)
 	}
-	return code, nil
+	return head, err
+}
+
+func (c *CachedClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	key := ""
+	if c.final(number) {
+		key = fmt.Sprintf(CacheKeyHeaderByNumber, number)
+	}
+	header, err := cachedCall(ctx, c, key, func(*types.Header) bool { return true }, func() (*types.Header, error) {
+		return c.Client.HeaderByNumber(ctx, number)
+	})
+	if err == nil && number == nil {
+		c.observeHead(header.Number.Uint64())
+	}
+	return header, err
+}
+
+func (c *CachedClient) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	key := ""
+	if c.final(number) {
+		key = fmt.Sprintf(CacheKeyBlockByNumber, number)
+	}
+	return cachedCall(ctx, c, key, func(*types.Block) bool { return true }, func() (*types.Block, error) {
+		return c.Client.BlockByNumber(ctx, number)
+	})
+}
+
+func (c *CachedClient) TransactionReceipt(ctx context.Context, txHash ethcommon.Hash) (*types.Receipt, error) {
+	key := fmt.Sprintf(CacheKeyTransactionReceipt, txHash)
+	return cachedCall(ctx, c, key, func(r *types.Receipt) bool { return c.final(r.BlockNumber) }, func() (*types.Receipt, error) {
+		return c.Client.TransactionReceipt(ctx, txHash)
+	})
+}
+
+func (c *CachedClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	key := ""
+	if c.final(blockNumber) {
+		msg, err := json.Marshal(call)
+		if err == nil {
+			key = fmt.Sprintf(CacheKeyCallContract, crypto.Keccak256Hash(msg), blockNumber)
+		}
+	}
+	return cachedCall(ctx, c, key, func([]byte) bool { return true }, func() ([]byte, error) {
+		return c.Client.CallContract(ctx, call, blockNumber)
+	})
+}
+
+func (c *CachedClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return cachedCall(ctx, c, "", nil, func() ([]types.Log, error) {
+		return c.Client.FilterLogs(ctx, q)
+	})
+}
+
+func (c *CachedClient) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	return c.retryWithBackOff(ctx, RetryCnt, func() error {
+		return CallContext(ctx, c.Client, result, method, args...)
+	})
 }
 
 type SimulatedClient struct {
@@ -210,3 +409,7 @@ func (c *SimulatedClient) SubscribeNewHead(ctx context.Context, ch chan<- *types
 	c.blockSub = append(c.blockSub, simSub)
 	return simSub, err
 }
+
+func (c *SimulatedClient) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	return CallContext(ctx, c.Client, result, method, args...)
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestCachedClient(t *testing.T) {
+	suite.Run(t, new(CachedClientTestSuite))
+}
+
+// flakyNode fails the first failures calls of every method
+type flakyNode struct {
+	Client
+	failures int
+	err      error
+	calls    int
+}
+
+func (n *flakyNode) Close() {}
+
+func (n *flakyNode) call() error {
+	n.calls++
+	if n.calls <= n.failures {
+		return n.err
+	}
+	return nil
+}
+
+func (n *flakyNode) BlockNumber(ctx context.Context) (uint64, error) {
+	return 100, n.call()
+}
+
+func (n *flakyNode) CodeAt(ctx context.Context, contract ethcommon.Address, blockNumber *big.Int) ([]byte, error) {
+	return []byte("code"), n.call()
+}
+
+func (n *flakyNode) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return &types.Header{Number: number}, n.call()
+}
+
+func (n *flakyNode) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	*result.(*string) = method
+	return n.call()
+}
+
+type CachedClientTestSuite struct {
+	suite.Suite
+
+	node   *flakyNode
+	client *CachedClient
+}
+
+func (s *CachedClientTestSuite) SetupTest() {
+	s.node = &flakyNode{err: errors.New("connection reset by peer")}
+	s.client = NewCachedClient(s.node, 16)
+}
+
+func (s *CachedClientTestSuite) TestRetryUntilSuccess() {
+	s.node.failures = 2
+	_, err := s.client.BlockNumber(context.Background())
+	s.NoError(err)
+	s.Equal(3, s.node.calls)
+}
+
+func (s *CachedClientTestSuite) TestNoRetryOnNotFound() {
+	s.node.failures = 1
+	s.node.err = ethereum.NotFound
+	_, err := s.client.BlockNumber(context.Background())
+	s.ErrorIs(err, ethereum.NotFound)
+	s.Equal(1, s.node.calls)
+}
+
+func (s *CachedClientTestSuite) TestRetryStopsOnContextDone() {
+	s.node.failures = RetryCnt + 1
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.client.BlockNumber(ctx)
+	s.ErrorIs(err, context.Canceled)
+	s.Equal(1, s.node.calls)
+}
+
+func (s *CachedClientTestSuite) TestCallContext() {
+	s.node.failures = 2
+	var result string
+	s.NoError(s.client.CallContext(context.Background(), &result, "debug_traceBlockByNumber"))
+	s.Equal("debug_traceBlockByNumber", result)
+	s.Equal(3, s.node.calls)
+
+	// not retried on clients which can not make raw calls
+	node := &fakeNode{}
+	err := NewCachedClient(node, 16).CallContext(context.Background(), &result, "debug_traceBlockByNumber")
+	s.ErrorIs(err, ErrRawCallUnsupported)
+}
+
+func (s *CachedClientTestSuite) TestCodeAtCache() {
+	for i := 0; i < 3; i++ {
+		code, err := s.client.CodeAt(context.Background(), ethcommon.Address{}, nil)
+		s.NoError(err)
+		s.Equal([]byte("code"), code)
+	}
+	s.Equal(1, s.node.calls)
+	s.Equal(CacheStats{Hits: 2, Misses: 1}, s.client.Stats())
+}
+
+func (s *CachedClientTestSuite) TestHeaderCacheOnlyWhenFinal() {
+	_, err := s.client.BlockNumber(context.Background())
+	s.NoError(err)
+
+	// not final yet
+	for i := 0; i < 2; i++ {
+		_, err = s.client.HeaderByNumber(context.Background(), big.NewInt(100))
+		s.NoError(err)
+	}
+	s.Equal(3, s.node.calls)
+
+	for i := 0; i < 2; i++ {
+		_, err = s.client.HeaderByNumber(context.Background(), big.NewInt(100-FinalityDepth))
+		s.NoError(err)
+	}
+	s.Equal(4, s.node.calls)
+}
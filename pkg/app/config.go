@@ -1,34 +1,151 @@
 package app
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/env"
 	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/v2"
+
+	"plutus/pkg/notice"
 )
 
 type Config struct {
-	CacheSize     int                      `koanf:"cache_size"`
-	NodeAddress   string                   `koanf:"node_address"`
-	DingtalkToken string                   `koanf:"dingtalk_token"`
-	BscScanToken  string                   `koanf:"bscscan_token"`
-	Services      map[string]ServiceConfig `koanf:"services"`
+	CacheSize      int                      `koanf:"cache_size"`
+	NodeAddress    string                   `koanf:"node_address"`
+	NodeAddresses  []string                 `koanf:"node_addresses"`
+	DingtalkToken  string                   `koanf:"dingtalk_token"`
+	BscScanToken   string                   `koanf:"bscscan_token"`
+	CheckpointFile string                   `koanf:"checkpoint_file"`
+	BackfillRange  uint64                   `koanf:"backfill_range"`
+	PollInterval   time.Duration            `koanf:"poll_interval"`
+	PollRange      uint64                   `koanf:"poll_range"`
+	Notice         notice.Config            `koanf:"notice"`
+	Services       map[string]ServiceConfig `koanf:"services"`
 }
 
 type ServiceConfig struct {
-	Enabled bool `koanf:"enabled"`
+	Enabled         bool   `koanf:"enabled"`
+	Confirmations   uint64 `koanf:"confirmations"`
+	NotifyRetracted bool   `koanf:"notify_retracted"`
+}
+
+// Endpoints returns every configured node address.
+func (c *Config) Endpoints() []string {
+	var ret []string
+	if c.NodeAddress != "" {
+		ret = append(ret, c.NodeAddress)
+	}
+	return append(ret, c.NodeAddresses...)
 }
 
-func readConfig() *koanf.Koanf {
+// NoticeConfig returns the notice config, with the dingtalk token falling back
+// to the top level dingtalk_token.
+func (c *Config) NoticeConfig() notice.Config {
+	cfg := c.Notice
+	if cfg.Dingtalk.Token == "" {
+		cfg.Dingtalk.Token = c.DingtalkToken
+	}
+	return cfg
+}
+
+const (
+	// EnvPrefix is the prefix of the environment variables overriding the
+	// config, e.g. PLUTUS_NODE_ADDRESS for node_address. Nested keys are
+	// separated by "__", e.g. PLUTUS_SERVICES__TRANSFER__CONFIG__THRESHOLD_VALUE
+	EnvPrefix = "PLUTUS_"
+
+	// SecretFileSuffix marks a key whose value is read from a file, for
+	// secrets (keys ending in token, secret or password), e.g.
+	// dingtalk_token_file or PLUTUS_BSCSCAN_TOKEN_FILE
+	SecretFileSuffix = "_file"
+)
+
+// DefaultConfigFiles are loaded if they exist and no config file is set.
+var DefaultConfigFiles = []string{"config.yaml", "conf/config.yaml"}
+
+var configFile string
+
+// SetConfigFile sets the config file to load instead of the default ones, it
+// must exist.
+func SetConfigFile(path string) {
+	configFile = path
+}
+
+func envKey(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(name, EnvPrefix)), "__", ".")
+}
+
+func isSecret(key string) bool {
+	for _, suffix := range []string{"token", "secret", "password"} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSecretFiles sets every secret key given as <key>_file to the content of
+// the file. The <key>_file keys are removed, they are not part of the config.
+func loadSecretFiles(k *koanf.Koanf) error {
+	secrets := map[string]any{}
+	for _, key := range k.Keys() {
+		secret, ok := strings.CutSuffix(key, SecretFileSuffix)
+		if !ok || !isSecret(secret) {
+			continue
+		}
+		path := k.String(key)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read %s failed: %w", key, err)
+		}
+		secrets[secret] = strings.TrimSpace(string(data))
+		k.Delete(key)
+	}
+	for key, value := range secrets {
+		if err := k.Set(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readConfig loads the config file, or the default ones which exist, then
+// the environment variables and secret files over them.
+func readConfig() (*koanf.Koanf, error) {
 	k := koanf.New(".")
-	_ = k.Load(file.Provider("config.yaml"), yaml.Parser())
-	_ = k.Load(file.Provider("conf/config.yaml"), yaml.Parser())
-	return k
+	if configFile != "" {
+		if err := k.Load(file.Provider(configFile), yaml.Parser()); err != nil {
+			return nil, fmt.Errorf("load config %s failed: %w", configFile, err)
+		}
+	} else {
+		for _, path := range DefaultConfigFiles {
+			err := k.Load(file.Provider(path), yaml.Parser())
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("load config %s failed: %w", path, err)
+			}
+		}
+	}
+	if err := k.Load(env.Provider(EnvPrefix, ".", envKey), nil); err != nil {
+		return nil, fmt.Errorf("load config from environment failed: %w", err)
+	}
+	if err := loadSecretFiles(k); err != nil {
+		return nil, err
+	}
+	return k, nil
 }
 
 func LoadConfig[T any](prefix string, cfg *T) error {
-	k := readConfig()
+	k, err := readConfig()
+	if err != nil {
+		return err
+	}
 	if err := k.Unmarshal(prefix, cfg); err != nil {
 		return err
 	}
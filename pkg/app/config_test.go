@@ -2,14 +2,18 @@ package app
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/agiledragon/gomonkey/v2"
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/rawbytes"
 	"github.com/knadh/koanf/v2"
-	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+
+	"plutus/pkg/notice"
 )
 
 func TestConfig(t *testing.T) {
@@ -60,13 +64,10 @@ services:
 		"dummy", s.expectedConfig.Services["dummy"].Enabled,
 		s.srv.config.Key1, s.srv.config.Key2)
 
-	s.patch.ApplyFunc(readConfig, func() *koanf.Koanf {
+	s.patch.ApplyFunc(readConfig, func() (*koanf.Koanf, error) {
 		k := koanf.New(".")
 		err := k.Load(rawbytes.Provider([]byte(s.rawConfig)), yaml.Parser())
-		if err != nil {
-			log.Error(err)
-		}
-		return k
+		return k, err
 	})
 }
 
@@ -80,6 +81,94 @@ func (s *ConfigTestSuite) TestLoadConfig() {
 	s.Equal(s.expectedConfig, &actualConfig)
 }
 
+func (s *ConfigTestSuite) TestNoticeConfig() {
+	cfg := Config{DingtalkToken: "token"}
+	s.Equal("token", cfg.NoticeConfig().Dingtalk.Token)
+
+	cfg.Notice.Dingtalk.Token = "override"
+	s.Equal("override", cfg.NoticeConfig().Dingtalk.Token)
+}
+
+func (s *ConfigTestSuite) TestLoadRoutes() {
+	s.rawConfig = `
+notice:
+  channels:
+    group-a:
+      notice: dingtalk
+      token: token-a
+  routes:
+    - services:
+        - constructor
+      severities:
+        - critical
+      groups:
+        - A
+      channels:
+        - group-a`
+	var actualConfig Config
+	s.NoError(LoadConfig("", &actualConfig))
+	s.Equal(map[string]notice.Channel{"group-a": {Notice: "dingtalk", Token: "token-a"}}, actualConfig.Notice.Channels)
+	s.Equal([]notice.Route{{
+		Services:   []string{"constructor"},
+		Severities: []notice.Severity{notice.SeverityCritical},
+		Groups:     []string{"A"},
+		Channels:   []string{"group-a"},
+	}}, actualConfig.Notice.Routes)
+}
+
+// writeConfig writes a config file in a temporary directory.
+func writeConfig(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func (s *ConfigTestSuite) TestReadConfig() {
+	s.patch.Reset()
+	defer SetConfigFile("")
+
+	SetConfigFile(writeConfig(s.T(), "config.yaml", s.rawConfig))
+	token := writeConfig(s.T(), "token", "secret-token\n")
+	s.T().Setenv("PLUTUS_NODE_ADDRESS", "wss://override")
+	s.T().Setenv("PLUTUS_SERVICES__DUMMY__CONFIG__KEY2", "env")
+	s.T().Setenv("PLUTUS_BSCSCAN_TOKEN_FILE", token)
+	s.T().Setenv("PLUTUS_CHECKPOINT_FILE", "checkpoint.json")
+
+	var actualConfig Config
+	s.NoError(LoadConfig("", &actualConfig))
+	s.Equal("wss://override", actualConfig.NodeAddress)
+	s.Equal(s.expectedConfig.CacheSize, actualConfig.CacheSize)
+	s.Equal("secret-token", actualConfig.BscScanToken)
+	s.Equal("checkpoint.json", actualConfig.CheckpointFile)
+
+	var srvConfig DummyServiceConfig
+	s.NoError(LoadServiceConfig("dummy", &srvConfig))
+	s.Equal(DummyServiceConfig{Key1: "value1", Key2: "env"}, srvConfig)
+
+	s.T().Setenv("PLUTUS_BSCSCAN_TOKEN_FILE", token+".missing")
+	s.ErrorContains(LoadConfig("", &actualConfig), "read bscscan_token_file failed")
+}
+
+func (s *ConfigTestSuite) TestReadConfigErrors() {
+	s.patch.Reset()
+	defer SetConfigFile("")
+	defaults := DefaultConfigFiles
+	defer func() { DefaultConfigFiles = defaults }()
+
+	var actualConfig Config
+	SetConfigFile(filepath.Join(s.T().TempDir(), "missing.yaml"))
+	s.ErrorContains(LoadConfig("", &actualConfig), "missing.yaml failed")
+
+	SetConfigFile(writeConfig(s.T(), "broken.yaml", "cache_size: [1"))
+	s.ErrorContains(LoadConfig("", &actualConfig), "broken.yaml failed")
+
+	SetConfigFile("")
+	DefaultConfigFiles = []string{filepath.Join(s.T().TempDir(), "missing.yaml")}
+	s.NoError(LoadConfig("", &actualConfig))
+	DefaultConfigFiles = []string{writeConfig(s.T(), "broken.yaml", "cache_size: [1")}
+	s.Error(LoadConfig("", &actualConfig))
+}
+
 func (s *ConfigTestSuite) TestLoadServiceConfig() {
 	var actualSrvConfig DummyServiceConfig
 	s.NoError(LoadServiceConfig("dummy", &actualSrvConfig))
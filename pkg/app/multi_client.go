@@ -0,0 +1,520 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+const (
+	HealthCheckInterval = 3 * time.Second
+	ResubscribeBackoff  = 10 * time.Second
+	// blocks below the last delivered log whose logs are still remembered,
+	// not to be delivered twice
+	relayWindow = 128
+
+	// ewmaWeight is the weight of the newest sample in latency and error rate
+	ewmaWeight = 0.2
+	// penalties are the latency a full error rate or one block of head lag
+	// are worth when scoring
+	errPenalty = 10 * time.Second
+	lagPenalty = time.Second
+)
+
+var _ Client = (*MultiClient)(nil)
+
+type endpoint struct {
+	url    string
+	client Client
+
+	mu      sync.Mutex
+	latency time.Duration
+	errRate float64
+	head    uint64
+}
+
+// subscribable reports whether the endpoint supports eth_subscribe or emulates
+// it by polling.
+func (e *endpoint) subscribable() bool {
+	_, polling := e.client.(*PollingClient)
+	return polling || !isHTTP(e.url)
+}
+
+func (e *endpoint) observe(latency time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	failed := 0.0
+	if isRetryable(err) {
+		failed = 1
+	}
+	if e.latency == 0 {
+		e.latency = latency
+	}
+	e.latency = time.Duration(float64(e.latency)*(1-ewmaWeight) + float64(latency)*ewmaWeight)
+	e.errRate = e.errRate*(1-ewmaWeight) + failed*ewmaWeight
+}
+
+// score is lower for healthier endpoints, see EndpointHealth for the inputs.
+func (e *endpoint) score(bestHead uint64) float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var lag uint64
+	if bestHead > e.head {
+		lag = bestHead - e.head
+	}
+	return float64(e.latency) + e.errRate*float64(errPenalty) + float64(lag)*float64(lagPenalty)
+}
+
+// EndpointHealth is a snapshot of the health metrics of an endpoint.
+type EndpointHealth struct {
+	URL       string
+	Latency   time.Duration
+	ErrorRate float64
+	Head      uint64
+	HeadLag   uint64
+}
+
+// MultiClient spreads calls over several nodes. Every call is routed to the
+// healthiest endpoint by latency, error rate and head lag, and fails over to
+// the next one on endpoint failures. Subscriptions are re-established on
+// another endpoint when the one serving them dies, log subscriptions replay
+// the logs missed in between.
+type MultiClient struct {
+	endpoints []*endpoint
+	quit      chan struct{}
+	closeOnce sync.Once
+}
+
+// DialMultiClient connects to every url with dial, endpoints which can not be
+// dialed are left out.
+func DialMultiClient(ctx context.Context, urls []string, dial func(context.Context, string) (Client, error)) (*MultiClient, error) {
+	clients := make([]Client, 0, len(urls))
+	dialed := make([]string, 0, len(urls))
+	var errs []error
+	for _, url := range urls {
+		client, err := dial(ctx, url)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("dial %s failed: %w", url, err))
+			continue
+		}
+		clients = append(clients, client)
+		dialed = append(dialed, url)
+	}
+	if len(clients) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	return NewMultiClient(dialed, clients), nil
+}
+
+// NewMultiClient wraps clients connected to urls, the url decides whether the
+// endpoint is used for subscriptions.
+func NewMultiClient(urls []string, clients []Client) *MultiClient {
+	m := &MultiClient{
+		quit: make(chan struct{}),
+	}
+	for i := range clients {
+		m.endpoints = append(m.endpoints, &endpoint{
+			url:    urls[i],
+			client: clients[i],
+		})
+	}
+	m.checkHealth()
+	go m.healthLoop()
+	return m
+}
+
+func (m *MultiClient) Close() {
+	m.closeOnce.Do(func() {
+		close(m.quit)
+		for _, e := range m.endpoints {
+			e.client.Close()
+		}
+	})
+}
+
+func (m *MultiClient) healthLoop() {
+	ticker := time.NewTicker(HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.quit:
+			return
+		case <-ticker.C:
+			m.checkHealth()
+		}
+	}
+}
+
+// checkHealth probes the head of every endpoint.
+func (m *MultiClient) checkHealth() {
+	wg := sync.WaitGroup{}
+	for i := range m.endpoints {
+		e := m.endpoints[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), HealthCheckInterval)
+			defer cancel()
+			start := time.Now()
+			head, err := e.client.BlockNumber(ctx)
+			e.observe(time.Since(start), err)
+			if err == nil {
+				e.mu.Lock()
+				e.head = head
+				e.mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (m *MultiClient) bestHead() uint64 {
+	var best uint64
+	for _, e := range m.endpoints {
+		e.mu.Lock()
+		if e.head > best {
+			best = e.head
+		}
+		e.mu.Unlock()
+	}
+	return best
+}
+
+// Health returns the health metrics of every endpoint.
+func (m *MultiClient) Health() []EndpointHealth {
+	best := m.bestHead()
+	ret := make([]EndpointHealth, 0, len(m.endpoints))
+	for _, e := range m.endpoints {
+		e.mu.Lock()
+		ret = append(ret, EndpointHealth{
+			URL:       e.url,
+			Latency:   e.latency,
+			ErrorRate: e.errRate,
+			Head:      e.head,
+			HeadLag:   best - e.head,
+		})
+		e.mu.Unlock()
+	}
+	return ret
+}
+
+// ranked returns the endpoints from the healthiest to the least healthy.
+func (m *MultiClient) ranked(subscribe bool) []*endpoint {
+	best := m.bestHead()
+	type scored struct {
+		*endpoint
+		score float64
+	}
+	var list []scored
+	for _, e := range m.endpoints {
+		if subscribe && !e.subscribable() {
+			continue
+		}
+		list = append(list, scored{e, e.score(best)})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].score < list[j].score
+	})
+	ret := make([]*endpoint, 0, len(list))
+	for _, s := range list {
+		ret = append(ret, s.endpoint)
+	}
+	return ret
+}
+
+func multiCall[T any](m *MultiClient, fn func(Client) (T, error)) (T, error) {
+	var (
+		ret T
+		err error
+	)
+	for _, e := range m.ranked(false) {
+		start := time.Now()
+		ret, err = fn(e.client)
+		e.observe(time.Since(start), err)
+		if !isRetryable(err) {
+			return ret, err
+		}
+	}
+	return ret, err
+}
+
+func multiExec(m *MultiClient, fn func(Client) error) error {
+	_, err := multiCall(m, func(c Client) (struct{}, error) {
+		return struct{}{}, fn(c)
+	})
+	return err
+}
+
+// subscribe establishes a subscription on the healthiest endpoint that
+// supports subscriptions.
+func (m *MultiClient) subscribe(fn func(Client) (ethereum.Subscription, error)) (*endpoint, ethereum.Subscription, error) {
+	endpoints := m.ranked(true)
+	if len(endpoints) == 0 {
+		return nil, nil, errors.New("no endpoint supports subscriptions")
+	}
+	var err error
+	for _, e := range endpoints {
+		var sub ethereum.Subscription
+		sub, err = fn(e.client)
+		if err == nil {
+			return e, sub, nil
+		}
+		e.observe(0, err)
+	}
+	return nil, nil, err
+}
+
+// relay passes the values of a subscription on, and replays the ones missed
+// while the subscription is re-established.
+type relay[T any] interface {
+	// pass reports whether v is to be delivered, it was not already
+	pass(v T) bool
+	replay(ctx context.Context) ([]T, error)
+}
+
+// multiSubscribe keeps a subscription to ch established on the healthiest
+// endpoint that supports subscriptions, the first one before it returns. When
+// the endpoint serving it dies, it is re-established on the next healthy one
+// and r, if any, replays the values missed in between.
+func multiSubscribe[T any](ctx context.Context, m *MultiClient, ch chan<- T, r relay[T],
+	fn func(Client, chan<- T) (ethereum.Subscription, error)) (ethereum.Subscription, error) {
+	inner := make(chan T)
+	subscribe := func(c Client) (ethereum.Subscription, error) {
+		return fn(c, inner)
+	}
+	serving, sub, err := m.subscribe(subscribe)
+	if err != nil {
+		return nil, err
+	}
+
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer func() {
+			if sub != nil {
+				sub.Unsubscribe()
+			}
+		}()
+		deliver := func(v T) bool {
+			if r != nil && !r.pass(v) {
+				return true
+			}
+			select {
+			case ch <- v:
+				return true
+			case <-quit:
+				return false
+			}
+		}
+		for {
+			select {
+			case v := <-inner:
+				if !deliver(v) {
+					return nil
+				}
+			case err := <-sub.Err():
+				serving.observe(0, err)
+				sub.Unsubscribe()
+				sub = nil
+				for sub == nil {
+					serving, sub, err = m.subscribe(subscribe)
+					if err == nil {
+						break
+					}
+					timer := time.NewTimer(ResubscribeBackoff)
+					select {
+					case <-quit:
+						timer.Stop()
+						return nil
+					case <-timer.C:
+					}
+				}
+				if r == nil {
+					continue
+				}
+				missed, err := r.replay(ctx)
+				if err != nil {
+					return fmt.Errorf("replay after resubscribing failed: %w", err)
+				}
+				for _, v := range missed {
+					if !deliver(v) {
+						return nil
+					}
+				}
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// logRelay keeps track of the logs delivered by a log subscription, to replay
+// the ones missed from the block of the last one and drop those delivered
+// twice.
+type logRelay struct {
+	client Client
+	query  ethereum.FilterQuery
+	// block of the last log delivered, or of the head when subscribed
+	last uint64
+	// logs delivered from relayWindow blocks below last -> block
+	delivered map[LogKey]uint64
+}
+
+func (r *logRelay) pass(log types.Log) bool {
+	key := KeyOf(log)
+	if log.Removed {
+		delete(r.delivered, key)
+		return true
+	}
+	if _, ok := r.delivered[key]; ok {
+		return false
+	}
+	r.delivered[key] = log.BlockNumber
+	if log.BlockNumber > r.last {
+		r.last = log.BlockNumber
+		for key, block := range r.delivered {
+			if block+relayWindow < r.last {
+				delete(r.delivered, key)
+			}
+		}
+	}
+	return true
+}
+
+func (r *logRelay) replay(ctx context.Context) ([]types.Log, error) {
+	if r.query.BlockHash != nil {
+		return nil, nil
+	}
+	query := r.query
+	query.FromBlock = new(big.Int).SetUint64(r.last)
+	query.ToBlock = nil
+	return r.client.FilterLogs(ctx, query)
+}
+
+func (m *MultiClient) BlockByHash(ctx context.Context, hash ethcommon.Hash) (*types.Block, error) {
+	return multiCall(m, func(c Client) (*types.Block, error) { return c.BlockByHash(ctx, hash) })
+}
+
+func (m *MultiClient) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	return multiCall(m, func(c Client) (*types.Block, error) { return c.BlockByNumber(ctx, number) })
+}
+
+func (m *MultiClient) HeaderByHash(ctx context.Context, hash ethcommon.Hash) (*types.Header, error) {
+	return multiCall(m, func(c Client) (*types.Header, error) { return c.HeaderByHash(ctx, hash) })
+}
+
+func (m *MultiClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return multiCall(m, func(c Client) (*types.Header, error) { return c.HeaderByNumber(ctx, number) })
+}
+
+func (m *MultiClient) TransactionCount(ctx context.Context, blockHash ethcommon.Hash) (uint, error) {
+	return multiCall(m, func(c Client) (uint, error) { return c.TransactionCount(ctx, blockHash) })
+}
+
+func (m *MultiClient) TransactionInBlock(ctx context.Context, blockHash ethcommon.Hash, index uint) (*types.Transaction, error) {
+	return multiCall(m, func(c Client) (*types.Transaction, error) { return c.TransactionInBlock(ctx, blockHash, index) })
+}
+
+func (m *MultiClient) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return multiSubscribe[*types.Header](ctx, m, ch, nil, func(c Client, ch chan<- *types.Header) (ethereum.Subscription, error) {
+		return c.SubscribeNewHead(ctx, ch)
+	})
+}
+
+func (m *MultiClient) TransactionByHash(ctx context.Context, txHash ethcommon.Hash) (*types.Transaction, bool, error) {
+	var isPending bool
+	tx, err := multiCall(m, func(c Client) (*types.Transaction, error) {
+		tx, pending, err := c.TransactionByHash(ctx, txHash)
+		isPending = pending
+		return tx, err
+	})
+	return tx, isPending, err
+}
+
+func (m *MultiClient) TransactionReceipt(ctx context.Context, txHash ethcommon.Hash) (*types.Receipt, error) {
+	return multiCall(m, func(c Client) (*types.Receipt, error) { return c.TransactionReceipt(ctx, txHash) })
+}
+
+func (m *MultiClient) BalanceAt(ctx context.Context, account ethcommon.Address, blockNumber *big.Int) (*big.Int, error) {
+	return multiCall(m, func(c Client) (*big.Int, error) { return c.BalanceAt(ctx, account, blockNumber) })
+}
+
+func (m *MultiClient) StorageAt(ctx context.Context, account ethcommon.Address, key ethcommon.Hash, blockNumber *big.Int) ([]byte, error) {
+	return multiCall(m, func(c Client) ([]byte, error) { return c.StorageAt(ctx, account, key, blockNumber) })
+}
+
+func (m *MultiClient) CodeAt(ctx context.Context, account ethcommon.Address, blockNumber *big.Int) ([]byte, error) {
+	return multiCall(m, func(c Client) ([]byte, error) { return c.CodeAt(ctx, account, blockNumber) })
+}
+
+func (m *MultiClient) NonceAt(ctx context.Context, account ethcommon.Address, blockNumber *big.Int) (uint64, error) {
+	return multiCall(m, func(c Client) (uint64, error) { return c.NonceAt(ctx, account, blockNumber) })
+}
+
+func (m *MultiClient) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	return multiCall(m, func(c Client) (*ethereum.FeeHistory, error) {
+		return c.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
+	})
+}
+
+func (m *MultiClient) BlockNumber(ctx context.Context) (uint64, error) {
+	return multiCall(m, func(c Client) (uint64, error) { return c.BlockNumber(ctx) })
+}
+
+func (m *MultiClient) ChainID(ctx context.Context) (*big.Int, error) {
+	return multiCall(m, func(c Client) (*big.Int, error) { return c.ChainID(ctx) })
+}
+
+func (m *MultiClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return multiCall(m, func(c Client) ([]byte, error) { return c.CallContract(ctx, call, blockNumber) })
+}
+
+func (m *MultiClient) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return multiCall(m, func(c Client) (uint64, error) { return c.EstimateGas(ctx, call) })
+}
+
+func (m *MultiClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return multiCall(m, func(c Client) (*big.Int, error) { return c.SuggestGasPrice(ctx) })
+}
+
+func (m *MultiClient) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return multiCall(m, func(c Client) (*big.Int, error) { return c.SuggestGasTipCap(ctx) })
+}
+
+func (m *MultiClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return multiExec(m, func(c Client) error { return c.SendTransaction(ctx, tx) })
+}
+
+func (m *MultiClient) PendingCodeAt(ctx context.Context, account ethcommon.Address) ([]byte, error) {
+	return multiCall(m, func(c Client) ([]byte, error) { return c.PendingCodeAt(ctx, account) })
+}
+
+func (m *MultiClient) PendingNonceAt(ctx context.Context, account ethcommon.Address) (uint64, error) {
+	return multiCall(m, func(c Client) (uint64, error) { return c.PendingNonceAt(ctx, account) })
+}
+
+func (m *MultiClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return multiCall(m, func(c Client) ([]types.Log, error) { return c.FilterLogs(ctx, q) })
+}
+
+func (m *MultiClient) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	head, err := m.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := &logRelay{client: m, query: q, last: head, delivered: map[LogKey]uint64{}}
+	return multiSubscribe[types.Log](ctx, m, ch, r, func(c Client, ch chan<- types.Log) (ethereum.Subscription, error) {
+		return c.SubscribeFilterLogs(ctx, q, ch)
+	})
+}
+
+func (m *MultiClient) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	return multiExec(m, func(c Client) error { return CallContext(ctx, c, result, method, args...) })
+}
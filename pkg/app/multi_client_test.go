@@ -0,0 +1,210 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestMultiClient(t *testing.T) {
+	suite.Run(t, new(MultiClientTestSuite))
+}
+
+type fakeNode struct {
+	Client
+	head  uint64
+	code  []byte
+	err   error
+	calls int
+	// fails the subscriptions served
+	kill chan error
+}
+
+func (n *fakeNode) Close() {}
+
+func (n *fakeNode) BlockNumber(ctx context.Context) (uint64, error) {
+	return n.head, n.err
+}
+
+func (n *fakeNode) CodeAt(ctx context.Context, contract ethcommon.Address, blockNumber *big.Int) ([]byte, error) {
+	n.calls++
+	return n.code, n.err
+}
+
+func (n *fakeNode) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	n.calls++
+	if n.err != nil {
+		return nil, n.err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		select {
+		case err := <-n.kill:
+			return err
+		case <-quit:
+			return nil
+		}
+	}), nil
+}
+
+type MultiClientTestSuite struct {
+	suite.Suite
+
+	healthy *fakeNode
+	broken  *fakeNode
+	lagging *fakeNode
+	client  *MultiClient
+}
+
+func (s *MultiClientTestSuite) SetupTest() {
+	s.healthy = &fakeNode{head: 100, code: []byte("healthy"), kill: make(chan error, 1)}
+	s.broken = &fakeNode{head: 100, err: errors.New("connection refused")}
+	s.lagging = &fakeNode{head: 10, code: []byte("lagging")}
+	s.client = NewMultiClient(
+		[]string{"wss://broken", "https://lagging", "wss://healthy"},
+		[]Client{s.broken, s.lagging, s.healthy},
+	)
+}
+
+func (s *MultiClientTestSuite) TearDownTest() {
+	s.client.Close()
+}
+
+func (s *MultiClientTestSuite) TestRouteToHealthiest() {
+	code, err := s.client.CodeAt(context.Background(), ethcommon.Address{}, nil)
+	s.NoError(err)
+	s.Equal([]byte("healthy"), code)
+	s.Equal(0, s.broken.calls)
+	s.Equal(0, s.lagging.calls)
+
+	health := s.client.Health()
+	s.Equal(uint64(90), health[1].HeadLag)
+	s.Greater(health[0].ErrorRate, 0.0)
+}
+
+func (s *MultiClientTestSuite) TestFailover() {
+	s.healthy.err = errors.New("i/o timeout")
+	code, err := s.client.CodeAt(context.Background(), ethcommon.Address{}, nil)
+	s.NoError(err)
+	s.Equal([]byte("lagging"), code)
+}
+
+func (s *MultiClientTestSuite) TestNoFailoverOnNotFound() {
+	s.healthy.err = ethereum.NotFound
+	_, err := s.client.CodeAt(context.Background(), ethcommon.Address{}, nil)
+	s.ErrorIs(err, ethereum.NotFound)
+	s.Equal(0, s.lagging.calls)
+}
+
+func (s *MultiClientTestSuite) TestSubscribe() {
+	sub, err := s.client.SubscribeNewHead(context.Background(), make(chan *types.Header))
+	s.NoError(err)
+	// established on the healthy endpoint right away, the http one is left out
+	s.Equal(1, s.healthy.calls)
+	s.Equal(0, s.lagging.calls)
+
+	// re-established rather than passed on
+	s.healthy.kill <- errors.New("connection reset")
+	s.Eventually(func() bool { return s.client.Health()[2].ErrorRate > 0 }, time.Second, time.Millisecond)
+	s.Never(func() bool { return len(sub.Err()) > 0 }, 50*time.Millisecond, time.Millisecond)
+	sub.Unsubscribe()
+	s.Equal(2, s.healthy.calls)
+
+	s.healthy.err = errors.New("connection refused")
+	_, err = s.client.SubscribeNewHead(context.Background(), make(chan *types.Header))
+	s.Error(err)
+}
+
+// logNode serves log subscriptions fed from feed until killed, and the
+// missed logs to filters.
+type logNode struct {
+	Client
+	feed       chan types.Log
+	kill       chan error
+	subscribed int
+	missed     []types.Log
+	from       *big.Int
+}
+
+func newLogNode() *logNode {
+	return &logNode{feed: make(chan types.Log), kill: make(chan error, 1)}
+}
+
+func (n *logNode) Close() {}
+
+func (n *logNode) BlockNumber(ctx context.Context) (uint64, error) {
+	return 10, nil
+}
+
+func (n *logNode) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	n.from = q.FromBlock
+	return n.missed, nil
+}
+
+func (n *logNode) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	n.subscribed++
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		for {
+			select {
+			case log := <-n.feed:
+				select {
+				case ch <- log:
+				case <-quit:
+					return nil
+				}
+			case err := <-n.kill:
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+func blockLog(block uint64) types.Log {
+	return types.Log{BlockNumber: block, BlockHash: ethcommon.BigToHash(new(big.Int).SetUint64(block))}
+}
+
+func TestMultiClientResubscribe(t *testing.T) {
+	a, b := newLogNode(), newLogNode()
+	m := NewMultiClient([]string{"wss://a", "wss://b"}, []Client{a, b})
+	defer m.Close()
+	ch := make(chan types.Log)
+	sub, err := m.SubscribeFilterLogs(context.Background(), ethereum.FilterQuery{}, ch)
+	require.NoError(t, err)
+	first, second := a, b
+	if b.subscribed == 1 {
+		first, second = b, a
+	}
+	require.Equal(t, 1, first.subscribed)
+
+	first.feed <- blockLog(11)
+	assert.Equal(t, blockLog(11), <-ch)
+
+	// replayed from the last delivered block on the next endpoint, the log
+	// delivered already is not delivered again
+	a.missed = []types.Log{blockLog(11), blockLog(12)}
+	b.missed = a.missed
+	first.kill <- errors.New("connection reset")
+	assert.Equal(t, blockLog(12), <-ch)
+	second.feed <- blockLog(12)
+	second.feed <- blockLog(13)
+	assert.Equal(t, blockLog(13), <-ch)
+
+	sub.Unsubscribe()
+	assert.Equal(t, 1, second.subscribed)
+	from := a.from
+	if from == nil {
+		from = b.from
+	}
+	assert.Equal(t, big.NewInt(11), from)
+}
@@ -0,0 +1,278 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+const (
+	DefaultPollInterval = 3 * time.Second
+	DefaultPollRange    = 500
+	// blocks below the last polled one whose logs are taken back if they are
+	// reorged out
+	reorgWindow = 128
+)
+
+var _ Client = (*PollingClient)(nil)
+
+// isHTTP reports whether the node at url only serves plain requests, so that
+// subscriptions have to be emulated by polling.
+func isHTTP(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
+
+// PollingClient emulates SubscribeFilterLogs and SubscribeNewHead by polling
+// BlockNumber and FilterLogs, for nodes that do not support eth_subscribe.
+// Like eth_subscribe, the logs of blocks reorged out are delivered again with
+// Removed set.
+type PollingClient struct {
+	Client
+	interval time.Duration
+	maxRange uint64
+}
+
+func NewPollingClient(client Client, interval time.Duration, maxRange uint64) *PollingClient {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	if maxRange == 0 {
+		maxRange = DefaultPollRange
+	}
+	return &PollingClient{
+		Client:   client,
+		interval: interval,
+		maxRange: maxRange,
+	}
+}
+
+// poll calls fn on every tick until fn returns done, quit is closed or fn
+// fails RetryCnt times in a row. ctx passed to fn is cancelled on quit.
+func (c *PollingClient) poll(quit <-chan struct{}, fn func(ctx context.Context) (done bool, err error)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-quit:
+			return nil
+		case <-ticker.C:
+		}
+
+		done, err := fn(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			failures++
+			if failures > RetryCnt {
+				return err
+			}
+			continue
+		}
+		failures = 0
+		if done {
+			return nil
+		}
+	}
+}
+
+// polledLogs remembers the logs delivered from the latest polled blocks and
+// the hash of the last polled block, which no longer matches after a reorg.
+type polledLogs struct {
+	// block -> logs delivered from it, of the last reorgWindow blocks
+	logs map[uint64][]types.Log
+	last uint64
+	hash ethcommon.Hash
+}
+
+func (p *polledLogs) add(log types.Log) {
+	p.logs[log.BlockNumber] = append(p.logs[log.BlockNumber], log)
+}
+
+// polled records the last polled block and forgets the logs of the blocks
+// too old to be reorged out.
+func (p *polledLogs) polled(header *types.Header) {
+	p.last, p.hash = header.Number.Uint64(), header.Hash()
+	for block := range p.logs {
+		if block+reorgWindow <= p.last {
+			delete(p.logs, block)
+		}
+	}
+}
+
+// reorged checks whether the last polled block is still in the chain. If it
+// is not, the logs delivered from the blocks after the fork are returned with
+// Removed set, newest first, along with the first block to poll again.
+func (c *PollingClient) reorged(ctx context.Context, p *polledLogs) ([]types.Log, uint64, error) {
+	header, err := c.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(p.last))
+	if err != nil {
+		return nil, 0, err
+	}
+	if header.Hash() == p.hash {
+		return nil, p.last + 1, nil
+	}
+
+	var blocks []uint64
+	for block := range p.logs {
+		blocks = append(blocks, block)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] > blocks[j] })
+	// blocks without logs are not known, the whole window is polled again
+	// unless a block with logs is still in the chain
+	next := uint64(0)
+	if p.last >= reorgWindow {
+		next = p.last - reorgWindow + 1
+	}
+	var removed []types.Log
+	for _, block := range blocks {
+		header, err := c.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(block))
+		if err != nil {
+			return nil, 0, err
+		}
+		logs := p.logs[block]
+		if header.Hash() == logs[0].BlockHash {
+			next = block + 1
+			break
+		}
+		for i := len(logs) - 1; i >= 0; i-- {
+			log := logs[i]
+			log.Removed = true
+			removed = append(removed, log)
+		}
+		delete(p.logs, block)
+	}
+	return removed, next, nil
+}
+
+func (c *PollingClient) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	var next uint64
+	if q.FromBlock != nil {
+		next = q.FromBlock.Uint64()
+	} else {
+		head, err := c.Client.BlockNumber(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get block number failed: %w", err)
+		}
+		next = head + 1
+	}
+
+	polled := &polledLogs{logs: map[uint64][]types.Log{}}
+	send := func(ctx context.Context, log types.Log) error {
+		select {
+		case ch <- log:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		return c.poll(quit, func(ctx context.Context) (bool, error) {
+			if polled.hash != (ethcommon.Hash{}) {
+				removed, from, err := c.reorged(ctx, polled)
+				if err != nil {
+					return false, err
+				}
+				for _, log := range removed {
+					if err := send(ctx, log); err != nil {
+						return false, err
+					}
+				}
+				next = from
+			}
+
+			head, err := c.Client.BlockNumber(ctx)
+			if err != nil {
+				return false, err
+			}
+			if q.ToBlock != nil && q.ToBlock.Uint64() < head {
+				head = q.ToBlock.Uint64()
+			}
+
+			for next <= head {
+				to := next + c.maxRange - 1
+				if to > head {
+					to = head
+				}
+				query := q
+				query.FromBlock = new(big.Int).SetUint64(next)
+				query.ToBlock = new(big.Int).SetUint64(to)
+				// taken first, a reorg before the logs are filtered is
+				// found on the next poll
+				header, err := c.Client.HeaderByNumber(ctx, query.ToBlock)
+				if err != nil {
+					return false, err
+				}
+				logs, err := c.Client.FilterLogs(ctx, query)
+				if err != nil {
+					return false, err
+				}
+				for _, log := range logs {
+					if err := send(ctx, log); err != nil {
+						return false, err
+					}
+					polled.add(log)
+				}
+				polled.polled(header)
+				next = to + 1
+			}
+			return q.ToBlock != nil && next > q.ToBlock.Uint64(), nil
+		})
+	}), nil
+}
+
+func (c *PollingClient) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	last, err := c.Client.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get block number failed: %w", err)
+	}
+
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		return c.poll(quit, func(ctx context.Context) (bool, error) {
+			head, err := c.Client.BlockNumber(ctx)
+			if err != nil {
+				return false, err
+			}
+			// only the latest maxRange headers are delivered after a long stall
+			if head > last+c.maxRange {
+				last = head - c.maxRange
+			}
+
+			for last < head {
+				header, err := c.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(last+1))
+				if err != nil {
+					return false, err
+				}
+				select {
+				case ch <- header:
+				case <-ctx.Done():
+					return false, ctx.Err()
+				}
+				last++
+			}
+			return false, nil
+		})
+	}), nil
+}
+
+func (c *PollingClient) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	return CallContext(ctx, c.Client, result, method, args...)
+}
@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestPollingClient(t *testing.T) {
+	suite.Run(t, new(PollingClientTestSuite))
+}
+
+// fakeChain has one log in every block, the blocks from fork are replaced if
+// it is set
+type fakeChain struct {
+	Client
+	mu      sync.Mutex
+	head    uint64
+	fork    uint64
+	queries []ethereum.FilterQuery
+}
+
+func (c *fakeChain) reorg(fork uint64, head uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fork, c.head = fork, head
+}
+
+func (c *fakeChain) header(number uint64) *types.Header {
+	header := &types.Header{Number: new(big.Int).SetUint64(number), Difficulty: big.NewInt(0)}
+	if c.fork != 0 && number >= c.fork {
+		header.Extra = []byte("fork")
+	}
+	return header
+}
+
+func (c *fakeChain) setHead(head uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.head = head
+}
+
+func (c *fakeChain) BlockNumber(ctx context.Context) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.head, nil
+}
+
+func (c *fakeChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.header(number.Uint64()), nil
+}
+
+func (c *fakeChain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries = append(c.queries, q)
+	var logs []types.Log
+	for i := q.FromBlock.Uint64(); i <= q.ToBlock.Uint64(); i++ {
+		logs = append(logs, types.Log{BlockNumber: i, BlockHash: c.header(i).Hash(), Topics: []ethcommon.Hash{}})
+	}
+	return logs, nil
+}
+
+type PollingClientTestSuite struct {
+	suite.Suite
+
+	chain  *fakeChain
+	client *PollingClient
+}
+
+func (s *PollingClientTestSuite) SetupTest() {
+	s.chain = &fakeChain{head: 100}
+	s.client = NewPollingClient(s.chain, 10*time.Millisecond, 4)
+}
+
+func (s *PollingClientTestSuite) TestSubscribeFilterLogs() {
+	ch := make(chan types.Log)
+	sub, err := s.client.SubscribeFilterLogs(context.Background(), ethereum.FilterQuery{}, ch)
+	s.NoError(err)
+	defer sub.Unsubscribe()
+
+	s.chain.setHead(110)
+	for i := uint64(101); i <= 110; i++ {
+		select {
+		case log := <-ch:
+			s.Equal(i, log.BlockNumber)
+		case <-time.After(time.Second):
+			s.FailNow("log not delivered")
+		}
+	}
+
+	s.chain.mu.Lock()
+	defer s.chain.mu.Unlock()
+	for _, q := range s.chain.queries {
+		s.LessOrEqual(q.ToBlock.Uint64()-q.FromBlock.Uint64()+1, uint64(4))
+	}
+}
+
+func (s *PollingClientTestSuite) TestReorg() {
+	ch := make(chan types.Log)
+	sub, err := s.client.SubscribeFilterLogs(context.Background(), ethereum.FilterQuery{}, ch)
+	s.NoError(err)
+	defer sub.Unsubscribe()
+
+	receive := func() types.Log {
+		select {
+		case log := <-ch:
+			return log
+		case <-time.After(time.Second):
+			s.FailNow("log not delivered")
+			return types.Log{}
+		}
+	}
+
+	s.chain.setHead(104)
+	var delivered []types.Log
+	for i := 0; i < 4; i++ {
+		delivered = append(delivered, receive())
+	}
+
+	// block 103 and 104 are replaced, their logs are taken back newest first
+	s.chain.reorg(103, 105)
+	for _, old := range []types.Log{delivered[3], delivered[2]} {
+		log := receive()
+		s.True(log.Removed)
+		s.Equal(old.BlockHash, log.BlockHash)
+	}
+	for i := uint64(103); i <= 105; i++ {
+		log := receive()
+		s.False(log.Removed)
+		s.Equal(i, log.BlockNumber)
+		s.NotEqual(delivered[2].BlockHash, log.BlockHash)
+	}
+}
+
+func (s *PollingClientTestSuite) TestSubscribeNewHead() {
+	ch := make(chan *types.Header)
+	sub, err := s.client.SubscribeNewHead(context.Background(), ch)
+	s.NoError(err)
+	defer sub.Unsubscribe()
+
+	s.chain.setHead(102)
+	for i := int64(101); i <= 102; i++ {
+		select {
+		case header := <-ch:
+			s.Equal(big.NewInt(i), header.Number)
+		case <-time.After(time.Second):
+			s.FailNow("header not delivered")
+		}
+	}
+}
+
+func (s *PollingClientTestSuite) TestUnsubscribe() {
+	ch := make(chan types.Log)
+	sub, err := s.client.SubscribeFilterLogs(context.Background(), ethereum.FilterQuery{}, ch)
+	s.NoError(err)
+	sub.Unsubscribe()
+
+	select {
+	case err := <-sub.Err():
+		s.NoError(err)
+	case <-time.After(time.Second):
+		s.FailNow("subscription not closed")
+	}
+}
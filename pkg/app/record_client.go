@@ -0,0 +1,384 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	_ Client = (*RecordingClient)(nil)
+	_ Client = (*ReplayClient)(nil)
+
+	ErrNotRecorded = errors.New("call not recorded")
+)
+
+// Fixture is the file format of recorded calls, keyed by method and params.
+type Fixture struct {
+	Calls map[string]FixtureCall `json:"calls"`
+}
+
+type FixtureCall struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type txByHash struct {
+	Tx        *types.Transaction `json:"tx"`
+	IsPending bool               `json:"isPending"`
+}
+
+func fixtureKey(method string, params ...any) (string, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", fmt.Errorf("encode %s params failed: %w", method, err)
+	}
+	return method + string(data), nil
+}
+
+// encodeResult encodes v as JSON, blocks have no JSON encoding and are
+// stored as RLP instead.
+func encodeResult(v any) (json.RawMessage, error) {
+	if block, ok := v.(*types.Block); ok {
+		if block == nil {
+			return json.Marshal(nil)
+		}
+		data, err := rlp.EncodeToBytes(block)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(data)
+	}
+	return json.Marshal(v)
+}
+
+func decodeResult[T any](data json.RawMessage) (T, error) {
+	var ret T
+	if len(data) == 0 {
+		return ret, nil
+	}
+	if _, ok := any(ret).(*types.Block); ok {
+		var raw []byte
+		if err := json.Unmarshal(data, &raw); err != nil || raw == nil {
+			return ret, err
+		}
+		block := new(types.Block)
+		if err := rlp.DecodeBytes(raw, block); err != nil {
+			return ret, err
+		}
+		return any(block).(T), nil
+	}
+	err := json.Unmarshal(data, &ret)
+	return ret, err
+}
+
+// RecordingClient captures the requests and responses of every read call, to
+// be saved as a fixture for a ReplayClient.
+type RecordingClient struct {
+	Client
+	mu    sync.Mutex
+	calls map[string]FixtureCall
+}
+
+func NewRecordingClient(client Client) *RecordingClient {
+	return &RecordingClient{
+		Client: client,
+		calls:  map[string]FixtureCall{},
+	}
+}
+
+func record[T any](c *RecordingClient, method string, params []any, fn func() (T, error)) (T, error) {
+	ret, err := fn()
+
+	key, keyErr := fixtureKey(method, params...)
+	if keyErr != nil {
+		return ret, err
+	}
+	call := FixtureCall{}
+	if err != nil {
+		call.Error = err.Error()
+	} else if call.Result, keyErr = encodeResult(ret); keyErr != nil {
+		return ret, err
+	}
+	c.mu.Lock()
+	c.calls[key] = call
+	c.mu.Unlock()
+	return ret, err
+}
+
+// Save writes every call recorded so far to a fixture file.
+func (c *RecordingClient) Save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.MarshalIndent(Fixture{Calls: c.calls}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (c *RecordingClient) BlockByHash(ctx context.Context, hash ethcommon.Hash) (*types.Block, error) {
+	return record(c, "BlockByHash", []any{hash}, func() (*types.Block, error) { return c.Client.BlockByHash(ctx, hash) })
+}
+
+func (c *RecordingClient) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	return record(c, "BlockByNumber", []any{number}, func() (*types.Block, error) { return c.Client.BlockByNumber(ctx, number) })
+}
+
+func (c *RecordingClient) HeaderByHash(ctx context.Context, hash ethcommon.Hash) (*types.Header, error) {
+	return record(c, "HeaderByHash", []any{hash}, func() (*types.Header, error) { return c.Client.HeaderByHash(ctx, hash) })
+}
+
+func (c *RecordingClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return record(c, "HeaderByNumber", []any{number}, func() (*types.Header, error) { return c.Client.HeaderByNumber(ctx, number) })
+}
+
+func (c *RecordingClient) TransactionCount(ctx context.Context, blockHash ethcommon.Hash) (uint, error) {
+	return record(c, "TransactionCount", []any{blockHash}, func() (uint, error) { return c.Client.TransactionCount(ctx, blockHash) })
+}
+
+func (c *RecordingClient) TransactionInBlock(ctx context.Context, blockHash ethcommon.Hash, index uint) (*types.Transaction, error) {
+	return record(c, "TransactionInBlock", []any{blockHash, index}, func() (*types.Transaction, error) {
+		return c.Client.TransactionInBlock(ctx, blockHash, index)
+	})
+}
+
+func (c *RecordingClient) TransactionByHash(ctx context.Context, txHash ethcommon.Hash) (*types.Transaction, bool, error) {
+	ret, err := record(c, "TransactionByHash", []any{txHash}, func() (txByHash, error) {
+		tx, isPending, err := c.Client.TransactionByHash(ctx, txHash)
+		return txByHash{tx, isPending}, err
+	})
+	return ret.Tx, ret.IsPending, err
+}
+
+func (c *RecordingClient) TransactionReceipt(ctx context.Context, txHash ethcommon.Hash) (*types.Receipt, error) {
+	return record(c, "TransactionReceipt", []any{txHash}, func() (*types.Receipt, error) { return c.Client.TransactionReceipt(ctx, txHash) })
+}
+
+func (c *RecordingClient) BalanceAt(ctx context.Context, account ethcommon.Address, blockNumber *big.Int) (*big.Int, error) {
+	return record(c, "BalanceAt", []any{account, blockNumber}, func() (*big.Int, error) {
+		return c.Client.BalanceAt(ctx, account, blockNumber)
+	})
+}
+
+func (c *RecordingClient) StorageAt(ctx context.Context, account ethcommon.Address, key ethcommon.Hash, blockNumber *big.Int) ([]byte, error) {
+	return record(c, "StorageAt", []any{account, key, blockNumber}, func() ([]byte, error) {
+		return c.Client.StorageAt(ctx, account, key, blockNumber)
+	})
+}
+
+func (c *RecordingClient) CodeAt(ctx context.Context, account ethcommon.Address, blockNumber *big.Int) ([]byte, error) {
+	return record(c, "CodeAt", []any{account, blockNumber}, func() ([]byte, error) {
+		return c.Client.CodeAt(ctx, account, blockNumber)
+	})
+}
+
+func (c *RecordingClient) NonceAt(ctx context.Context, account ethcommon.Address, blockNumber *big.Int) (uint64, error) {
+	return record(c, "NonceAt", []any{account, blockNumber}, func() (uint64, error) {
+		return c.Client.NonceAt(ctx, account, blockNumber)
+	})
+}
+
+func (c *RecordingClient) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	return record(c, "FeeHistory", []any{blockCount, lastBlock, rewardPercentiles}, func() (*ethereum.FeeHistory, error) {
+		return c.Client.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
+	})
+}
+
+func (c *RecordingClient) BlockNumber(ctx context.Context) (uint64, error) {
+	return record(c, "BlockNumber", nil, func() (uint64, error) { return c.Client.BlockNumber(ctx) })
+}
+
+func (c *RecordingClient) ChainID(ctx context.Context) (*big.Int, error) {
+	return record(c, "ChainID", nil, func() (*big.Int, error) { return c.Client.ChainID(ctx) })
+}
+
+func (c *RecordingClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return record(c, "CallContract", []any{call, blockNumber}, func() ([]byte, error) {
+		return c.Client.CallContract(ctx, call, blockNumber)
+	})
+}
+
+func (c *RecordingClient) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return record(c, "EstimateGas", []any{call}, func() (uint64, error) { return c.Client.EstimateGas(ctx, call) })
+}
+
+func (c *RecordingClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return record(c, "SuggestGasPrice", nil, func() (*big.Int, error) { return c.Client.SuggestGasPrice(ctx) })
+}
+
+func (c *RecordingClient) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return record(c, "SuggestGasTipCap", nil, func() (*big.Int, error) { return c.Client.SuggestGasTipCap(ctx) })
+}
+
+func (c *RecordingClient) PendingCodeAt(ctx context.Context, account ethcommon.Address) ([]byte, error) {
+	return record(c, "PendingCodeAt", []any{account}, func() ([]byte, error) { return c.Client.PendingCodeAt(ctx, account) })
+}
+
+func (c *RecordingClient) PendingNonceAt(ctx context.Context, account ethcommon.Address) (uint64, error) {
+	return record(c, "PendingNonceAt", []any{account}, func() (uint64, error) { return c.Client.PendingNonceAt(ctx, account) })
+}
+
+func (c *RecordingClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return record(c, "FilterLogs", []any{q}, func() ([]types.Log, error) { return c.Client.FilterLogs(ctx, q) })
+}
+
+// ReplayClient serves the calls of a fixture recorded by a RecordingClient,
+// without any network access. Subscriptions never deliver anything by
+// themselves, use a SimulatedClient on top to publish recorded blocks.
+type ReplayClient struct {
+	calls map[string]FixtureCall
+}
+
+func LoadReplayClient(path string) (*ReplayClient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("parse fixture %s failed: %w", path, err)
+	}
+	return &ReplayClient{calls: fixture.Calls}, nil
+}
+
+func replay[T any](c *ReplayClient, method string, params ...any) (T, error) {
+	var ret T
+	key, err := fixtureKey(method, params...)
+	if err != nil {
+		return ret, err
+	}
+	call, ok := c.calls[key]
+	if !ok {
+		return ret, fmt.Errorf("%w: %s", ErrNotRecorded, key)
+	}
+	if call.Error != "" {
+		if call.Error == ethereum.NotFound.Error() {
+			return ret, ethereum.NotFound
+		}
+		return ret, errors.New(call.Error)
+	}
+	return decodeResult[T](call.Result)
+}
+
+// NewIdleSubscription returns a subscription which never delivers anything
+// until it is unsubscribed.
+func NewIdleSubscription() ethereum.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+func (c *ReplayClient) Close() {}
+
+func (c *ReplayClient) BlockByHash(ctx context.Context, hash ethcommon.Hash) (*types.Block, error) {
+	return replay[*types.Block](c, "BlockByHash", hash)
+}
+
+func (c *ReplayClient) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	return replay[*types.Block](c, "BlockByNumber", number)
+}
+
+func (c *ReplayClient) HeaderByHash(ctx context.Context, hash ethcommon.Hash) (*types.Header, error) {
+	return replay[*types.Header](c, "HeaderByHash", hash)
+}
+
+func (c *ReplayClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return replay[*types.Header](c, "HeaderByNumber", number)
+}
+
+func (c *ReplayClient) TransactionCount(ctx context.Context, blockHash ethcommon.Hash) (uint, error) {
+	return replay[uint](c, "TransactionCount", blockHash)
+}
+
+func (c *ReplayClient) TransactionInBlock(ctx context.Context, blockHash ethcommon.Hash, index uint) (*types.Transaction, error) {
+	return replay[*types.Transaction](c, "TransactionInBlock", blockHash, index)
+}
+
+func (c *ReplayClient) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return NewIdleSubscription(), nil
+}
+
+func (c *ReplayClient) TransactionByHash(ctx context.Context, txHash ethcommon.Hash) (*types.Transaction, bool, error) {
+	ret, err := replay[txByHash](c, "TransactionByHash", txHash)
+	return ret.Tx, ret.IsPending, err
+}
+
+func (c *ReplayClient) TransactionReceipt(ctx context.Context, txHash ethcommon.Hash) (*types.Receipt, error) {
+	return replay[*types.Receipt](c, "TransactionReceipt", txHash)
+}
+
+func (c *ReplayClient) BalanceAt(ctx context.Context, account ethcommon.Address, blockNumber *big.Int) (*big.Int, error) {
+	return replay[*big.Int](c, "BalanceAt", account, blockNumber)
+}
+
+func (c *ReplayClient) StorageAt(ctx context.Context, account ethcommon.Address, key ethcommon.Hash, blockNumber *big.Int) ([]byte, error) {
+	return replay[[]byte](c, "StorageAt", account, key, blockNumber)
+}
+
+func (c *ReplayClient) CodeAt(ctx context.Context, account ethcommon.Address, blockNumber *big.Int) ([]byte, error) {
+	return replay[[]byte](c, "CodeAt", account, blockNumber)
+}
+
+func (c *ReplayClient) NonceAt(ctx context.Context, account ethcommon.Address, blockNumber *big.Int) (uint64, error) {
+	return replay[uint64](c, "NonceAt", account, blockNumber)
+}
+
+func (c *ReplayClient) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	return replay[*ethereum.FeeHistory](c, "FeeHistory", blockCount, lastBlock, rewardPercentiles)
+}
+
+func (c *ReplayClient) BlockNumber(ctx context.Context) (uint64, error) {
+	return replay[uint64](c, "BlockNumber")
+}
+
+func (c *ReplayClient) ChainID(ctx context.Context) (*big.Int, error) {
+	return replay[*big.Int](c, "ChainID")
+}
+
+func (c *ReplayClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return replay[[]byte](c, "CallContract", call, blockNumber)
+}
+
+func (c *ReplayClient) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return replay[uint64](c, "EstimateGas", call)
+}
+
+func (c *ReplayClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return replay[*big.Int](c, "SuggestGasPrice")
+}
+
+func (c *ReplayClient) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return replay[*big.Int](c, "SuggestGasTipCap")
+}
+
+func (c *ReplayClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return errors.New("replay client can not send transactions")
+}
+
+func (c *ReplayClient) PendingCodeAt(ctx context.Context, account ethcommon.Address) ([]byte, error) {
+	return replay[[]byte](c, "PendingCodeAt", account)
+}
+
+func (c *ReplayClient) PendingNonceAt(ctx context.Context, account ethcommon.Address) (uint64, error) {
+	return replay[uint64](c, "PendingNonceAt", account)
+}
+
+func (c *ReplayClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return replay[[]types.Log](c, "FilterLogs", q)
+}
+
+func (c *ReplayClient) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return NewIdleSubscription(), nil
+}
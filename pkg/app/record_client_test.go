@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestRecordClient(t *testing.T) {
+	suite.Run(t, new(RecordClientTestSuite))
+}
+
+type RecordClientTestSuite struct {
+	suite.Suite
+
+	path string
+}
+
+func (s *RecordClientTestSuite) SetupTest() {
+	s.path = filepath.Join(s.T().TempDir(), "fixture.json")
+
+	recorder := NewRecordingClient(&fakeChain{head: 100})
+	ctx := context.Background()
+	_, err := recorder.BlockNumber(ctx)
+	s.NoError(err)
+	_, err = recorder.HeaderByNumber(ctx, big.NewInt(100))
+	s.NoError(err)
+	_, err = recorder.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: big.NewInt(100),
+		ToBlock:   big.NewInt(100),
+		Addresses: []ethcommon.Address{ethcommon.HexToAddress("0x01")},
+	})
+	s.NoError(err)
+	s.NoError(recorder.Save(s.path))
+}
+
+func (s *RecordClientTestSuite) TestReplay() {
+	replay, err := LoadReplayClient(s.path)
+	s.NoError(err)
+	ctx := context.Background()
+
+	head, err := replay.BlockNumber(ctx)
+	s.NoError(err)
+	s.Equal(uint64(100), head)
+
+	header, err := replay.HeaderByNumber(ctx, big.NewInt(100))
+	s.NoError(err)
+	s.Equal(big.NewInt(100), header.Number)
+
+	logs, err := replay.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: big.NewInt(100),
+		ToBlock:   big.NewInt(100),
+		Addresses: []ethcommon.Address{ethcommon.HexToAddress("0x01")},
+	})
+	s.NoError(err)
+	s.Len(logs, 1)
+	s.Equal(uint64(100), logs[0].BlockNumber)
+}
+
+func (s *RecordClientTestSuite) TestNotRecorded() {
+	replay, err := LoadReplayClient(s.path)
+	s.NoError(err)
+
+	_, err = replay.HeaderByNumber(context.Background(), big.NewInt(101))
+	s.True(errors.Is(err, ErrNotRecorded))
+}
+
+func (s *RecordClientTestSuite) TestSimulatedReplay() {
+	replay, err := LoadReplayClient(s.path)
+	s.NoError(err)
+	client := NewSimulatedClient(replay, big.NewInt(99))
+	defer client.Close()
+
+	ch := make(chan types.Log, 1)
+	_, err = client.SubscribeFilterLogs(context.Background(), ethereum.FilterQuery{
+		Addresses: []ethcommon.Address{ethcommon.HexToAddress("0x01")},
+	}, ch)
+	s.NoError(err)
+	s.NoError(client.FetchNewBlock())
+	s.Equal(uint64(100), (<-ch).BlockNumber)
+
+	// block 101 is not recorded
+	s.ErrorIs(client.FetchNewBlock(), ErrNotRecorded)
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/knadh/koanf/providers/file"
+
+	"plutus/pkg/notice"
+)
+
+// ReloadDelay is how long config changes settle before they are reloaded,
+// editors often write a file several times when saving it.
+const ReloadDelay = 500 * time.Millisecond
+
+// ReloadService is the service name reload notices are sent as.
+const ReloadService = "config"
+
+// Reloadable is a service taking its new config without restarting, the
+// service loads its config again in Reload.
+type Reloadable interface {
+	Reload(config *Config) error
+}
+
+// configFiles returns the config files loaded, which are watched.
+func configFiles() []string {
+	if configFile != "" {
+		return []string{configFile}
+	}
+	var ret []string
+	for _, path := range DefaultConfigFiles {
+		if _, err := os.Stat(path); err == nil {
+			ret = append(ret, path)
+		}
+	}
+	return ret
+}
+
+// WatchConfig calls onChange once the config files stop changing for
+// ReloadDelay.
+func WatchConfig(onChange func(), onError func(err error)) error {
+	var timer *time.Timer
+	changes := make(chan struct{}, 1)
+	for _, path := range configFiles() {
+		path := path
+		err := file.Provider(path).Watch(func(_ interface{}, err error) {
+			if err != nil {
+				onError(fmt.Errorf("watch config %s stopped: %w", path, err))
+				return
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("watch config %s failed: %w", path, err)
+		}
+	}
+	go func() {
+		for range changes {
+			if timer == nil {
+				timer = time.AfterFunc(ReloadDelay, onChange)
+			} else {
+				timer.Reset(ReloadDelay)
+			}
+		}
+	}()
+	return nil
+}
+
+// changedKeys returns the keys whose values differ between the flattened
+// configs.
+func changedKeys(old map[string]any, new map[string]any) []string {
+	var ret []string
+	for key, value := range new {
+		if oldValue, ok := old[key]; !ok || !reflect.DeepEqual(oldValue, value) {
+			ret = append(ret, key)
+		}
+	}
+	for key := range old {
+		if _, ok := new[key]; !ok {
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// serviceOf returns the service whose config the key is under, if any.
+func serviceOf(key string) (string, bool) {
+	parts := strings.SplitN(key, ".", 4)
+	if len(parts) < 3 || parts[0] != "services" || parts[2] != "config" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// reload validates the changed config and hands it to the reloadable
+// services. Other changes only take effect after a restart.
+func (app *App) reload() {
+	log := app.log.WithField("service", ReloadService)
+	if err := ValidateConfig(); err != nil {
+		log.Errorf("config not reloaded, invalid config:\n%s", err)
+		return
+	}
+	k, err := readConfig()
+	if err != nil {
+		log.Errorf("config not reloaded: %s", err)
+		return
+	}
+	var config Config
+	if err := k.Unmarshal("", &config); err != nil {
+		log.Errorf("config not reloaded: %s", err)
+		return
+	}
+
+	app.mu.Lock()
+	changed := changedKeys(app.keys, k.All())
+	app.keys = k.All()
+	app.mu.Unlock()
+	if len(changed) == 0 {
+		return
+	}
+
+	reloaded := map[string]bool{}
+	var applied, restart []string
+	for _, key := range changed {
+		name, ok := serviceOf(key)
+		srv, running := app.services[name]
+		reloadable, isReloadable := srv.(Reloadable)
+		if !ok || !running || !isReloadable {
+			restart = append(restart, key)
+			continue
+		}
+		applied = append(applied, key)
+		if reloaded[name] {
+			continue
+		}
+		reloaded[name] = true
+		if err := reloadable.Reload(&config); err != nil {
+			log.WithField("reload", name).Errorf("reload failed: %s", err)
+		}
+	}
+
+	log.WithField("applied", applied).
+		WithField("restart required", restart).
+		Info("Config reloaded")
+	alert := &notice.Alert{
+		Service:  ReloadService,
+		Severity: notice.SeverityInfo,
+		Title:    notice.Label("reload_title"),
+		Time:     time.Now(),
+	}
+	if len(applied) > 0 {
+		alert.Tags = append(alert.Tags, notice.Tag{Name: "applied", Value: strings.Join(applied, ", ")})
+	}
+	if len(restart) > 0 {
+		alert.Tags = append(alert.Tags, notice.Tag{Name: "applied_after_restart", Value: strings.Join(restart, ", ")})
+	}
+	notice.BroadCast(alert, nil)
+}
+
+func init() {
+	notice.RegisterLabels(notice.LanguageZh, map[string]string{
+		"reload_title":          "配置已重新加载",
+		"applied":               "已生效",
+		"applied_after_restart": "重启后生效",
+	})
+	notice.RegisterLabels(notice.LanguageEn, map[string]string{
+		"reload_title":          "Config reloaded",
+		"applied":               "Applied",
+		"applied_after_restart": "Applied After Restart",
+	})
+}
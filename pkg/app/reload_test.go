@@ -0,0 +1,163 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/rawbytes"
+	"github.com/knadh/koanf/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+
+	"plutus/pkg/notice"
+)
+
+func TestReload(t *testing.T) {
+	suite.Run(t, new(ReloadTestSuite))
+}
+
+type ReloadTestSuite struct {
+	suite.Suite
+
+	patch     *gomonkey.Patches
+	rawConfig string
+	srv       *ReloadingService
+	alerts    []*notice.Alert
+}
+
+// ReloadingService remembers the configs it is reloaded with.
+type ReloadingService struct {
+	mu      sync.Mutex
+	configs []*Config
+}
+
+func (*ReloadingService) Name() string                            { return "reloading" }
+func (*ReloadingService) Init(*Config, *Status, *log.Entry) error { return nil }
+func (*ReloadingService) Run(context.Context) error               { return nil }
+
+func (srv *ReloadingService) Reload(config *Config) error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.configs = append(srv.configs, config)
+	return nil
+}
+
+func (s *ReloadTestSuite) SetupTest() {
+	s.srv = &ReloadingService{}
+	s.alerts = nil
+	RegisterService(s.srv)
+	s.patch = gomonkey.NewPatches()
+	s.patch.ApplyFunc(readConfig, func() (*koanf.Koanf, error) {
+		k := koanf.New(".")
+		err := k.Load(rawbytes.Provider([]byte(s.rawConfig)), yaml.Parser())
+		return k, err
+	})
+	s.patch.ApplyFunc(notice.BroadCast, func(msg notice.Msg, srv any) {
+		s.alerts = append(s.alerts, msg.(*notice.Alert))
+	})
+}
+
+func (s *ReloadTestSuite) TearDownTest() {
+	s.patch.Reset()
+	delete(services, s.srv.Name())
+}
+
+func (s *ReloadTestSuite) app() *App {
+	s.rawConfig = `
+node_address: wss://node
+services:
+  reloading:
+    enabled: true
+    config:
+      wallets:
+        - "0x95D4ce9cF81AB59E3607Db4de46BD576A4ED3018"`
+	app := NewApp("test", &Config{Services: map[string]ServiceConfig{"reloading": {Enabled: true}}}, log.New())
+	k, err := readConfig()
+	s.Require().NoError(err)
+	app.keys = k.All()
+	return app
+}
+
+func (s *ReloadTestSuite) TestReload() {
+	app := s.app()
+	s.rawConfig = `
+node_address: wss://other
+services:
+  reloading:
+    enabled: true
+    config:
+      wallets:
+        - "0x95D4ce9cF81AB59E3607Db4de46BD576A4ED3018"
+        - "0x8894E0a0c962CB723c1976a4421c95949bE2D4E3"`
+	app.reload()
+
+	s.Require().Len(s.srv.configs, 1)
+	s.Equal("wss://other", s.srv.configs[0].NodeAddress)
+	s.Require().Len(s.alerts, 1)
+	s.Equal([]notice.Tag{
+		{Name: "applied", Value: "services.reloading.config.wallets"},
+		{Name: "applied_after_restart", Value: "node_address"},
+	}, s.alerts[0].Tags)
+
+	app.reload()
+	s.Len(s.srv.configs, 1)
+	s.Len(s.alerts, 1)
+}
+
+func (s *ReloadTestSuite) TestInvalid() {
+	app := s.app()
+	s.rawConfig = `
+node_address: wss://node
+services:
+  reloading:
+    enabled: true
+    config:
+      wallets: [1, 2]
+  unknown:
+    enabled: true`
+	app.reload()
+	s.Empty(s.srv.configs)
+	s.Empty(s.alerts)
+}
+
+func (s *ReloadTestSuite) TestWatchConfig() {
+	s.patch.Reset()
+	defer SetConfigFile("")
+	path := filepath.Join(s.T().TempDir(), "config.yaml")
+	s.Require().NoError(os.WriteFile(path, []byte("cache_size: 1"), 0o600))
+	SetConfigFile(path)
+
+	changes := make(chan struct{}, 10)
+	s.Require().NoError(WatchConfig(func() { changes <- struct{}{} }, func(error) {}))
+	for i := 0; i < 3; i++ {
+		s.Require().NoError(os.WriteFile(path, []byte("cache_size: 2"), 0o600))
+	}
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		s.Fail("change not noticed")
+	}
+	select {
+	case <-changes:
+		s.Fail("changes not debounced")
+	case <-time.After(2 * ReloadDelay):
+	}
+}
+
+func (s *ReloadTestSuite) TestChangedKeys() {
+	s.Equal([]string{"a", "c", "d"}, changedKeys(
+		map[string]any{"a": 1, "b": []any{"x"}, "c": 3},
+		map[string]any{"a": 2, "b": []any{"x"}, "d": 4},
+	))
+	name, ok := serviceOf("services.transfer.config.wallets")
+	s.True(ok)
+	s.Equal("transfer", name)
+	_, ok = serviceOf("services.transfer.enabled")
+	s.False(ok)
+}
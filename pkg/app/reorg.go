@@ -0,0 +1,86 @@
+package app
+
+import (
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// LogKey identifies a log within a specific block, a log re-included by a
+// reorg gets a different key.
+type LogKey struct {
+	BlockHash ethcommon.Hash
+	TxHash    ethcommon.Hash
+	Index     uint
+}
+
+func KeyOf(log types.Log) LogKey {
+	return LogKey{
+		BlockHash: log.BlockHash,
+		TxHash:    log.TxHash,
+		Index:     log.Index,
+	}
+}
+
+// ConfirmQueue holds back events until their block is buried under enough
+// confirmations, so short reorgs are resolved before anything is handled.
+type ConfirmQueue[T any] struct {
+	depth   uint64
+	raw     func(T) types.Log
+	pending []T
+}
+
+// NewConfirmQueue creates a queue which releases events depth blocks after
+// their block, raw extracts the underlying log of an event.
+func NewConfirmQueue[T any](depth uint64, raw func(T) types.Log) *ConfirmQueue[T] {
+	return &ConfirmQueue[T]{
+		depth: depth,
+		raw:   raw,
+	}
+}
+
+func (q *ConfirmQueue[T]) Depth() uint64 {
+	return q.depth
+}
+
+// Push adds an event to the queue. Events ready for handling right away, i.e.
+// when no confirmations are required, are returned as ready.
+//
+// A removed log cancels its pending event. If there is none, the event was
+// released before and is returned as retracted.
+func (q *ConfirmQueue[T]) Push(event T) (ready []T, retracted []T) {
+	log := q.raw(event)
+	if log.Removed {
+		key := KeyOf(log)
+		for i := range q.pending {
+			if KeyOf(q.raw(q.pending[i])) == key {
+				q.pending = append(q.pending[:i], q.pending[i+1:]...)
+				return nil, nil
+			}
+		}
+		return nil, []T{event}
+	}
+
+	if q.depth == 0 {
+		return []T{event}, nil
+	}
+	q.pending = append(q.pending, event)
+	return nil, nil
+}
+
+// Confirm releases the pending events which are confirmed at the head block.
+func (q *ConfirmQueue[T]) Confirm(head uint64) []T {
+	if q.depth == 0 || head < q.depth {
+		return nil
+	}
+	var ready []T
+	pending := q.pending[:0]
+	for _, event := range q.pending {
+		if q.raw(event).BlockNumber+q.depth <= head {
+			ready = append(ready, event)
+		} else {
+			pending = append(pending, event)
+		}
+	}
+	q.pending = pending
+	return ready
+}
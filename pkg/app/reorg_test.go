@@ -0,0 +1,65 @@
+package app
+
+import (
+	"testing"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestConfirmQueue(t *testing.T) {
+	suite.Run(t, new(ConfirmQueueTestSuite))
+}
+
+type ConfirmQueueTestSuite struct {
+	suite.Suite
+}
+
+func (s *ConfirmQueueTestSuite) newLog(block uint64, tx byte, removed bool) *types.Log {
+	return &types.Log{
+		BlockNumber: block,
+		BlockHash:   ethcommon.BigToHash(ethcommon.Big1),
+		TxHash:      ethcommon.BytesToHash([]byte{tx}),
+		Removed:     removed,
+	}
+}
+
+func (s *ConfirmQueueTestSuite) newQueue(depth uint64) *ConfirmQueue[*types.Log] {
+	return NewConfirmQueue(depth, func(l *types.Log) types.Log { return *l })
+}
+
+func (s *ConfirmQueueTestSuite) TestNoConfirmations() {
+	q := s.newQueue(0)
+	log := s.newLog(10, 1, false)
+	ready, retracted := q.Push(log)
+	s.Equal([]*types.Log{log}, ready)
+	s.Empty(retracted)
+
+	removed := s.newLog(10, 1, true)
+	ready, retracted = q.Push(removed)
+	s.Empty(ready)
+	s.Equal([]*types.Log{removed}, retracted)
+}
+
+func (s *ConfirmQueueTestSuite) TestConfirm() {
+	q := s.newQueue(3)
+	a, b := s.newLog(10, 1, false), s.newLog(11, 2, false)
+	ready, _ := q.Push(a)
+	s.Empty(ready)
+	q.Push(b)
+
+	s.Empty(q.Confirm(12))
+	s.Equal([]*types.Log{a}, q.Confirm(13))
+	s.Equal([]*types.Log{b}, q.Confirm(14))
+	s.Empty(q.Confirm(15))
+}
+
+func (s *ConfirmQueueTestSuite) TestRemovedBeforeConfirmed() {
+	q := s.newQueue(3)
+	q.Push(s.newLog(10, 1, false))
+	ready, retracted := q.Push(s.newLog(10, 1, true))
+	s.Empty(ready)
+	s.Empty(retracted)
+	s.Empty(q.Confirm(20))
+}
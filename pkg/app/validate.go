@@ -0,0 +1,215 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/knadh/koanf/v2"
+	"github.com/mitchellh/mapstructure"
+	"github.com/shopspring/decimal"
+)
+
+// Validator collects the problems of a config under a key, so they are all
+// reported at once.
+type Validator struct {
+	prefix string
+	errs   *[]error
+}
+
+func NewValidator() *Validator {
+	return &Validator{errs: &[]error{}}
+}
+
+// Sub returns a validator of the keys under key, sharing the problems.
+func (v *Validator) Sub(key string) *Validator {
+	return &Validator{prefix: v.key(key), errs: v.errs}
+}
+
+func (v *Validator) key(key string) string {
+	if v.prefix == "" {
+		return key
+	}
+	if key == "" || strings.HasPrefix(key, "[") {
+		return v.prefix + key
+	}
+	return v.prefix + "." + key
+}
+
+// Errorf reports a problem of the key.
+func (v *Validator) Errorf(key string, format string, args ...any) {
+	err := fmt.Errorf(format, args...)
+	if key := v.key(key); key != "" {
+		err = fmt.Errorf("%s: %w", key, err)
+	}
+	*v.errs = append(*v.errs, err)
+}
+
+// Add reports every problem of err, which already names its keys.
+func (v *Validator) Add(err error) {
+	if err == nil {
+		return
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			v.Add(err)
+		}
+		return
+	}
+	*v.errs = append(*v.errs, err)
+}
+
+// Required reports the key if its value is empty.
+func (v *Validator) Required(key string, value string) {
+	if value == "" {
+		v.Errorf(key, "is required")
+	}
+}
+
+// Address checks an address, its checksum too if it is in mixed case.
+func (v *Validator) Address(key string, value string) {
+	if !common.IsHexAddress(value) {
+		v.Errorf(key, "%q is not an address", value)
+		return
+	}
+	hex := strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X")
+	if hex != strings.ToLower(hex) && hex != strings.ToUpper(hex) {
+		if checksummed := common.HexToAddress(value).Hex(); checksummed != value {
+			v.Errorf(key, "%q has a bad checksum, expected %s", value, checksummed)
+		}
+	}
+}
+
+// Decimal checks a decimal amount, empty values are not checked.
+func (v *Validator) Decimal(key string, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := decimal.NewFromString(value); err != nil {
+		v.Errorf(key, "%q is not a decimal", value)
+	}
+}
+
+// URL checks an absolute url of one of the schemes, empty values are not
+// checked.
+func (v *Validator) URL(key string, value string, schemes ...string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		v.Errorf(key, "%q is not a url", value)
+		return
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return
+		}
+	}
+	v.Errorf(key, "%q is not a %s url", value, strings.Join(schemes, "/"))
+}
+
+// Err returns every problem reported, nil if there are none.
+func (v *Validator) Err() error {
+	return errors.Join(*v.errs...)
+}
+
+// decode unmarshals the key strictly into cfg, reporting type errors and the
+// keys cfg does not have. Keys under skip are left to be checked on their own.
+func (v *Validator) decode(k *koanf.Koanf, key string, cfg any, skip func(key string) bool) bool {
+	var md mapstructure.Metadata
+	err := k.UnmarshalWithConf(key, cfg, koanf.UnmarshalConf{
+		DecoderConfig: &mapstructure.DecoderConfig{
+			DecodeHook: mapstructure.ComposeDecodeHookFunc(
+				mapstructure.StringToTimeDurationHookFunc(),
+				mapstructure.TextUnmarshallerHookFunc()),
+			Metadata:         &md,
+			Result:           cfg,
+			WeaklyTypedInput: true,
+		},
+	})
+	var decodeErr *mapstructure.Error
+	if errors.As(err, &decodeErr) {
+		for _, e := range decodeErr.Errors {
+			v.Errorf("", "%s", e)
+		}
+	} else if err != nil {
+		v.Errorf("", "%s", err)
+	}
+
+	sort.Strings(md.Unused)
+	for _, unused := range md.Unused {
+		unused = strings.NewReplacer("[", ".", "]", "").Replace(unused)
+		if skip == nil || !skip(unused) {
+			v.Errorf(unused, "unknown key")
+		}
+	}
+	return err == nil
+}
+
+// ValidateServiceConfig loads the config of the service into cfg like
+// LoadServiceConfig, reporting its problems. It returns the validator of the
+// service config keys and whether cfg was loaded, for the service to check
+// the values.
+func ValidateServiceConfig[T any](v *Validator, srvName string, cfg *T) (*Validator, bool) {
+	key := fmt.Sprintf("services.%s.config", srvName)
+	sub := v.Sub(key)
+	k, err := readConfig()
+	if err != nil {
+		v.Add(err)
+		return sub, false
+	}
+	return sub, sub.decode(k, key, cfg, nil)
+}
+
+// ConfigValidator is a service checking its config before the app starts.
+type ConfigValidator interface {
+	ValidateConfig(v *Validator)
+}
+
+// ValidateConfig checks the config and the config of every enabled service,
+// all the problems are reported at once.
+func ValidateConfig() error {
+	k, err := readConfig()
+	if err != nil {
+		return err
+	}
+	v := NewValidator()
+	var config Config
+	v.decode(k, "", &config, func(key string) bool {
+		// checked by the services
+		parts := strings.Split(key, ".")
+		return len(parts) >= 3 && parts[0] == "services" && parts[2] == "config"
+	})
+
+	if len(config.Endpoints()) == 0 {
+		v.Errorf("node_address", "is required")
+	}
+	if config.NodeAddress != "" {
+		v.URL("node_address", config.NodeAddress, "ws", "wss", "http", "https")
+	}
+	for i, addr := range config.NodeAddresses {
+		v.URL(fmt.Sprintf("node_addresses[%d]", i), addr, "ws", "wss", "http", "https")
+	}
+	v.Add(config.NoticeConfig().Validate())
+
+	names := make([]string, 0, len(config.Services))
+	for name := range config.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		srv, ok := services[name]
+		if !ok {
+			v.Errorf("services."+name, "unknown service")
+			continue
+		}
+		if validator, ok := srv.(ConfigValidator); ok && config.Services[name].Enabled {
+			validator.ValidateConfig(v)
+		}
+	}
+	return v.Err()
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/rawbytes"
+	"github.com/knadh/koanf/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestValidate(t *testing.T) {
+	suite.Run(t, new(ValidateTestSuite))
+}
+
+type ValidateTestSuite struct {
+	suite.Suite
+
+	patch     *gomonkey.Patches
+	rawConfig string
+}
+
+// ValidatingService checks an address and an amount in its config.
+type ValidatingService struct{}
+
+type ValidatingServiceConfig struct {
+	Wallet string `koanf:"wallet"`
+	Amount string `koanf:"amount"`
+}
+
+func (ValidatingService) Name() string                            { return "validating" }
+func (ValidatingService) Init(*Config, *Status, *log.Entry) error { return nil }
+func (ValidatingService) Run(context.Context) error               { return nil }
+
+func (srv ValidatingService) ValidateConfig(v *Validator) {
+	var cfg ValidatingServiceConfig
+	v, ok := ValidateServiceConfig(v, srv.Name(), &cfg)
+	if !ok {
+		return
+	}
+	v.Address("wallet", cfg.Wallet)
+	v.Decimal("amount", cfg.Amount)
+}
+
+func (s *ValidateTestSuite) SetupTest() {
+	RegisterService(ValidatingService{})
+	s.patch = gomonkey.NewPatches()
+	s.patch.ApplyFunc(readConfig, func() (*koanf.Koanf, error) {
+		k := koanf.New(".")
+		err := k.Load(rawbytes.Provider([]byte(s.rawConfig)), yaml.Parser())
+		return k, err
+	})
+}
+
+func (s *ValidateTestSuite) TearDownTest() {
+	s.patch.Reset()
+	delete(services, ValidatingService{}.Name())
+}
+
+func (s *ValidateTestSuite) TestValid() {
+	s.rawConfig = `
+node_address: wss://bsc-ws-node.nariox.org
+services:
+  validating:
+    enabled: true
+    config:
+      wallet: "0x8894E0a0c962CB723c1976a4421c95949bE2D4E3"
+      amount: "1000.5"`
+	s.NoError(ValidateConfig())
+}
+
+func (s *ValidateTestSuite) TestSecretFile() {
+	s.patch.Reset()
+	defer SetConfigFile("")
+
+	token := writeConfig(s.T(), "token", "secret-token\n")
+	SetConfigFile(writeConfig(s.T(), "config.yaml", `
+node_address: wss://bsc-ws-node.nariox.org
+dingtalk_token_file: `+token+`
+notice:
+  dingtalk:
+    secret_file: `+token))
+	s.NoError(ValidateConfig())
+}
+
+func (s *ValidateTestSuite) TestInvalid() {
+	s.rawConfig = `
+cache_size: lots
+node_addresses:
+  - bsc.example.com
+notice:
+  dingtalk:
+    tokne: typo
+  channels:
+    ops:
+      notice: pager
+  routes:
+    - channels:
+        - missing
+services:
+  validating:
+    enabled: true
+    config:
+      wallet: "0x8894e0a0c962cb723c1976a4421c95949be2d4E3"
+      amount: 2k
+      extra: true
+  unknown:
+    enabled: true`
+	err := ValidateConfig()
+	s.Require().Error(err)
+	problems := strings.Split(err.Error(), "\n")
+	s.Len(problems, 9, err.Error())
+	s.Contains(err.Error(), `cannot parse 'cache_size' as int`)
+	s.Contains(err.Error(), "notice.dingtalk.tokne: unknown key")
+	s.Contains(err.Error(), `node_addresses[0]: "bsc.example.com" is not a url`)
+	s.Contains(err.Error(), `notice.channels.ops.notice: unknown notice "pager"`)
+	s.Contains(err.Error(), `notice.routes[0].channels: unknown channel "missing"`)
+	s.Contains(err.Error(), "services.unknown: unknown service")
+	s.Contains(err.Error(), "services.validating.config.extra: unknown key")
+	s.Contains(err.Error(), `services.validating.config.wallet: "0x8894e0a0c962cb723c1976a4421c95949be2d4E3" has a bad checksum, expected 0x8894E0a0c962CB723c1976a4421c95949bE2D4E3`)
+	s.Contains(err.Error(), `services.validating.config.amount: "2k" is not a decimal`)
+}
+
+func (s *ValidateTestSuite) TestMissingNode() {
+	s.rawConfig = `cache_size: 1024`
+	s.EqualError(ValidateConfig(), "node_address: is required")
+}
+
+func (s *ValidateTestSuite) TestValidator() {
+	v := NewValidator()
+	v.Address("lower", "0x8894e0a0c962cb723c1976a4421c95949be2d4e3")
+	v.Address("short", "0x8894")
+	sub := v.Sub("nested")
+	sub.URL("ws", "wss://node", "wss")
+	sub.URL("scheme", "ftp://node", "http", "https")
+	sub.Required("[0]", "")
+	s.EqualError(v.Err(), `short: "0x8894" is not an address
+nested.scheme: "ftp://node" is not a http/https url
+nested[0]: is required`)
+}
@@ -0,0 +1,305 @@
+// Package fingerprint compares contracts by their runtime code. Codes are
+// reduced to their opcodes, without the compiler metadata and the operands of
+// PUSH, so addresses and immutables set at deployment do not matter, and
+// compared by the MinHash signatures of their opcode n-grams.
+//
+// Contracts recompiled with other optimizer settings have other opcodes, they
+// are compared by their ABI surface too: the function selectors of their
+// dispatch table and the event topics they log.
+package fingerprint
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+const (
+	// NGram is the number of consecutive opcodes shingled together
+	NGram = 5
+	// SignatureSize is the number of MinHash values in a signature, the
+	// similarity estimates are within 1/sqrt(SignatureSize) or so
+	SignatureSize = 128
+)
+
+const (
+	opStop         = 0x00
+	opEq           = 0x14
+	opDup1         = 0x80
+	opDup16        = 0x8f
+	opPush1        = 0x60
+	opPush4        = 0x63
+	opPush32       = 0x7f
+	opLog1         = 0xa1
+	opLog4         = 0xa4
+	opReturn       = 0xf3
+	opRevert       = 0xfd
+	opInvalid      = 0xfe
+	opSelfDestruct = 0xff
+)
+
+// topicWindow is how many instructions after a PUSH32 a LOG may use it as its
+// topic.
+const topicWindow = 64
+
+// metadataKeys are the CBOR keys solc puts in the metadata trailer
+var metadataKeys = [][]byte{[]byte("ipfs"), []byte("bzzr0"), []byte("bzzr1"), []byte("solc"), []byte("experimental")}
+
+// seeds of the hash functions of a signature
+var seeds = func() [SignatureSize]uint64 {
+	var ret [SignatureSize]uint64
+	seed := uint64(0x706c75747573)
+	for i := range ret {
+		seed = splitmix64(seed)
+		ret[i] = seed
+	}
+	return ret
+}()
+
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// StripMetadata returns code without the CBOR metadata solc appends, which
+// ends with its length in 2 bytes. Code without metadata is returned as is.
+func StripMetadata(code []byte) []byte {
+	if len(code) < 2 {
+		return code
+	}
+	size := int(binary.BigEndian.Uint16(code[len(code)-2:]))
+	start := len(code) - 2 - size
+	if size == 0 || start < 0 {
+		return code
+	}
+	metadata := code[start : len(code)-2]
+	// a CBOR map of up to 7 entries
+	if metadata[0] < 0xa1 || metadata[0] > 0xa7 {
+		return code
+	}
+	for _, key := range metadataKeys {
+		if bytes.Contains(metadata, key) {
+			return code[:start]
+		}
+	}
+	return code
+}
+
+// Opcodes disassembles code into its opcodes, dropping the operands of PUSH.
+func Opcodes(code []byte) []byte {
+	ins := disassemble(code)
+	ret := make([]byte, 0, len(ins))
+	for _, i := range ins {
+		ret = append(ret, i.op)
+	}
+	return ret
+}
+
+// instruction is an opcode and the operand of PUSH.
+type instruction struct {
+	op      byte
+	operand []byte
+}
+
+func disassemble(code []byte) []instruction {
+	var ret []instruction
+	for i := 0; i < len(code); i++ {
+		ins := instruction{op: code[i]}
+		if ins.op >= opPush1 && ins.op <= opPush32 {
+			end := i + 1 + int(ins.op-opPush1) + 1
+			if end > len(code) {
+				end = len(code)
+			}
+			ins.operand = code[i+1 : end]
+			i = end - 1
+		}
+		ret = append(ret, ins)
+	}
+	return ret
+}
+
+func terminal(op byte) bool {
+	switch op {
+	case opStop, opReturn, opRevert, opInvalid, opSelfDestruct:
+		return true
+	}
+	return false
+}
+
+// Selectors returns the function selectors of the dispatch table of code, the
+// PUSH4 constants compared with EQ right after, possibly through a DUP.
+func Selectors(code []byte) [][4]byte {
+	ins := disassemble(StripMetadata(code))
+	var ret [][4]byte
+	seen := map[[4]byte]bool{}
+	for i := range ins {
+		if ins[i].op != opPush4 || len(ins[i].operand) != 4 {
+			continue
+		}
+		j := i + 1
+		if j < len(ins) && ins[j].op >= opDup1 && ins[j].op <= opDup16 {
+			j++
+		}
+		if j >= len(ins) || ins[j].op != opEq {
+			continue
+		}
+		var selector [4]byte
+		copy(selector[:], ins[i].operand)
+		if !seen[selector] {
+			seen[selector] = true
+			ret = append(ret, selector)
+		}
+	}
+	return ret
+}
+
+// Topics returns the event topics of code, the PUSH32 constants followed by a
+// LOG1 to LOG4 within a few instructions, before the execution ends.
+func Topics(code []byte) [][32]byte {
+	ins := disassemble(StripMetadata(code))
+	var ret [][32]byte
+	seen := map[[32]byte]bool{}
+	for i := range ins {
+		if ins[i].op != opPush32 || len(ins[i].operand) != 32 || mask(ins[i].operand) {
+			continue
+		}
+		for j := i + 1; j < len(ins) && j <= i+topicWindow && !terminal(ins[j].op); j++ {
+			if ins[j].op < opLog1 || ins[j].op > opLog4 {
+				continue
+			}
+			var topic [32]byte
+			copy(topic[:], ins[i].operand)
+			if !seen[topic] {
+				seen[topic] = true
+				ret = append(ret, topic)
+			}
+			break
+		}
+	}
+	return ret
+}
+
+// mask reports whether a constant looks like a bit mask or a small number
+// rather than a hash, starting with 4 bytes of 0x00 or 0xff.
+func mask(value []byte) bool {
+	for _, b := range []byte{0x00, 0xff} {
+		if bytes.Equal(value[:4], []byte{b, b, b, b}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fingerprint is the MinHash signature of the opcode n-grams of a contract,
+// and its ABI surface.
+type Fingerprint struct {
+	// number of opcodes, without the metadata
+	Size      int
+	Signature [SignatureSize]uint64
+	Selectors [][4]byte
+	Topics    [][32]byte
+}
+
+// Weights weighs the similarities of the bytecode and of the ABI surface of
+// contracts in their score.
+type Weights struct {
+	Bytecode float64
+	ABI      float64
+}
+
+// BytecodeOnly scores contracts by their bytecode alone.
+var BytecodeOnly = Weights{Bytecode: 1}
+
+// New fingerprints the runtime code of a contract, nil if there is no code.
+func New(code []byte) *Fingerprint {
+	ops := Opcodes(StripMetadata(code))
+	if len(ops) == 0 {
+		return nil
+	}
+	f := &Fingerprint{Size: len(ops), Selectors: Selectors(code), Topics: Topics(code)}
+	for i := range f.Signature {
+		f.Signature[i] = math.MaxUint64
+	}
+
+	n := NGram
+	if len(ops) < n {
+		n = len(ops)
+	}
+	seen := map[uint64]bool{}
+	for i := 0; i+n <= len(ops); i++ {
+		h := fnv.New64a()
+		_, _ = h.Write(ops[i : i+n])
+		shingle := h.Sum64()
+		if seen[shingle] {
+			continue
+		}
+		seen[shingle] = true
+		for j, seed := range seeds {
+			if v := splitmix64(shingle ^ seed); v < f.Signature[j] {
+				f.Signature[j] = v
+			}
+		}
+	}
+	return f
+}
+
+// Similarity estimates the Jaccard similarity of the opcode n-grams of the
+// contracts, from 0 to 1. Contracts without code are similar to nothing.
+func (f *Fingerprint) Similarity(other *Fingerprint) float64 {
+	if f == nil || other == nil {
+		return 0
+	}
+	same := 0
+	for i := range f.Signature {
+		if f.Signature[i] == other.Signature[i] {
+			same++
+		}
+	}
+	return float64(same) / SignatureSize
+}
+
+// ABISimilarity returns the Jaccard similarity of the function selectors and
+// event topics of the contracts, 0 if neither has any.
+func (f *Fingerprint) ABISimilarity(other *Fingerprint) float64 {
+	if f == nil || other == nil {
+		return 0
+	}
+	surface := map[string]int{}
+	for _, fp := range []*Fingerprint{f, other} {
+		for _, selector := range fp.Selectors {
+			surface[string(selector[:])]++
+		}
+		for _, topic := range fp.Topics {
+			surface[string(topic[:])]++
+		}
+	}
+	if len(surface) == 0 {
+		return 0
+	}
+	both := 0
+	for _, cnt := range surface {
+		if cnt == 2 {
+			both++
+		}
+	}
+	return float64(both) / float64(len(surface))
+}
+
+// Score combines the similarities of the bytecode and of the ABI surface by
+// their weights, from 0 to 1. Zero weights score by the bytecode alone.
+func (f *Fingerprint) Score(other *Fingerprint, w Weights) float64 {
+	if w.Bytecode < 0 || w.ABI < 0 || w.Bytecode+w.ABI == 0 {
+		w = BytecodeOnly
+	}
+	score := 0.0
+	if w.Bytecode > 0 {
+		score += w.Bytecode * f.Similarity(other)
+	}
+	if w.ABI > 0 {
+		score += w.ABI * f.ABISimilarity(other)
+	}
+	return score / (w.Bytecode + w.ABI)
+}
@@ -0,0 +1,129 @@
+package fingerprint
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestFingerprint(t *testing.T) {
+	suite.Run(t, new(FingerprintTestSuite))
+}
+
+type FingerprintTestSuite struct {
+	suite.Suite
+}
+
+// code returns n random instructions, PUSH20 of addr every 10 of them.
+func code(seed int64, n int, addr byte) []byte {
+	r := rand.New(rand.NewSource(seed))
+	var ret []byte
+	for i := 0; i < n; i++ {
+		if i%10 == 0 {
+			ret = append(ret, opPush1+19)
+			for j := 0; j < 20; j++ {
+				ret = append(ret, addr)
+			}
+			continue
+		}
+		// no PUSH, so the instructions do not swallow each other
+		ret = append(ret, byte(r.Intn(opPush1)))
+	}
+	return ret
+}
+
+// metadata returns a solc metadata trailer with the hash.
+func metadata(hash byte) []byte {
+	cbor := []byte{0xa2, 0x64, 'i', 'p', 'f', 's', 0x58, 0x22}
+	for i := 0; i < 0x22; i++ {
+		cbor = append(cbor, hash)
+	}
+	cbor = append(cbor, 0x64, 's', 'o', 'l', 'c', 0x43, 0x00, 0x08, 0x13)
+	return append(cbor, 0x00, byte(len(cbor)))
+}
+
+func (s *FingerprintTestSuite) TestStripMetadata() {
+	c := code(1, 100, 0x11)
+	s.Equal(c, StripMetadata(append(append([]byte(nil), c...), metadata(0xaa)...)))
+	s.Equal(c, StripMetadata(c))
+	s.Empty(StripMetadata(nil))
+}
+
+func (s *FingerprintTestSuite) TestOpcodes() {
+	s.Equal([]byte{0x60, 0x01, 0x7f}, Opcodes([]byte{0x60, 0xff, 0x01, 0x7f}))
+}
+
+func (s *FingerprintTestSuite) TestSimilarity() {
+	a := New(append(code(1, 500, 0x11), metadata(0xaa)...))
+	s.NotNil(a)
+	s.Equal(500, a.Size)
+
+	// other addresses and metadata
+	s.Equal(1.0, a.Similarity(New(append(code(1, 500, 0x22), metadata(0xbb)...))))
+	// a few instructions added
+	s.Greater(a.Similarity(New(append(code(1, 500, 0x11), code(2, 20, 0x11)...))), 0.8)
+	// other contract
+	s.Less(a.Similarity(New(code(3, 500, 0x11))), 0.2)
+}
+
+func (s *FingerprintTestSuite) TestEmpty() {
+	s.Nil(New(nil))
+	s.Nil(New(metadata(0xaa)))
+	s.Equal(0.0, New(nil).Similarity(New(code(1, 100, 0x11))))
+	s.Equal(0.0, New(code(1, 100, 0x11)).Similarity(nil))
+}
+
+// abi returns a dispatch table of the selectors and a function logging the
+// topics, its instructions shuffled by seed.
+func abi(seed int64, selectors []uint32, topics []byte) []byte {
+	ret := []byte{0x60, 0xe0, 0x1c}
+	for _, selector := range selectors {
+		ret = append(ret, 0x80, opPush4, byte(selector>>24), byte(selector>>16), byte(selector>>8), byte(selector), opEq, 0x61, 0x01, 0x00, 0x57)
+	}
+	ret = append(ret, 0x5b)
+	for _, topic := range topics {
+		ret = append(ret, opPush32)
+		for i := 0; i < 32; i++ {
+			ret = append(ret, topic)
+		}
+		ret = append(ret, code(seed, 5, 0x11)...)
+		ret = append(ret, opLog1)
+	}
+	return append(ret, 0x00)
+}
+
+func (s *FingerprintTestSuite) TestSelectors() {
+	c := abi(1, []uint32{0xa9059cbb, 0x70a08231}, []byte{0xdd})
+	s.Equal([][4]byte{{0xa9, 0x05, 0x9c, 0xbb}, {0x70, 0xa0, 0x82, 0x31}}, Selectors(c))
+	s.Equal([][32]byte{bytes32(0xdd)}, Topics(c))
+
+	// masks and constants not logged are not topics
+	s.Empty(Topics(abi(1, nil, []byte{0xff})))
+	s.Empty(Topics(append([]byte{opPush32}, append(code(1, 32, 0x11)[:32], 0x00, opLog1)...)))
+}
+
+func bytes32(b byte) [32]byte {
+	var ret [32]byte
+	for i := range ret {
+		ret[i] = b
+	}
+	return ret
+}
+
+func (s *FingerprintTestSuite) TestABISimilarity() {
+	a := New(append(code(1, 500, 0x11), abi(1, []uint32{1 << 24, 2 << 24, 3 << 24}, []byte{0xdd})...))
+	// recompiled, other bytecode with the same functions and events
+	b := New(append(code(2, 500, 0x11), abi(2, []uint32{1 << 24, 2 << 24, 3 << 24}, []byte{0xdd})...))
+	s.Less(a.Similarity(b), 0.5)
+	s.Equal(1.0, a.ABISimilarity(b))
+	s.InDelta((a.Similarity(b)+3)/4, a.Score(b, Weights{Bytecode: 1, ABI: 3}), 1e-9)
+
+	c := New(append(code(1, 500, 0x11), abi(1, []uint32{1 << 24, 4 << 24}, []byte{0xee})...))
+	s.InDelta(1.0/6, a.ABISimilarity(c), 1e-9)
+	s.Equal(a.Similarity(b), a.Score(b, BytecodeOnly))
+	s.Equal(a.Similarity(b), a.Score(b, Weights{}))
+
+	s.Equal(0.0, New(code(1, 100, 0x11)).ABISimilarity(New(code(1, 100, 0x11))))
+	s.Equal(0.0, a.ABISimilarity(nil))
+}
@@ -0,0 +1,51 @@
+package fingerprint
+
+import (
+	"bytes"
+)
+
+const opDelegateCall = 0xf4
+
+var (
+	// EIP-1167 minimal proxy, around the PUSH of the implementation address
+	minimalProxyPrefix = []byte{0x36, 0x3d, 0x3d, 0x37, 0x3d, 0x3d, 0x3d, 0x36, 0x3d}
+	// the byte after PUSH1 is the return offset, which moves with the length
+	// of the address
+	minimalProxySuffix = [][]byte{
+		{0x5a, 0xf4, 0x3d, 0x82, 0x80, 0x3e, 0x90, 0x3d, 0x91, 0x60},
+		{0x57, 0xfd, 0x5b, 0xf3},
+	}
+)
+
+// MinimalProxy returns the implementation of an EIP-1167 minimal proxy, also
+// of vanity addresses pushed with fewer than 20 bytes.
+func MinimalProxy(code []byte) ([20]byte, bool) {
+	var implementation [20]byte
+	if !bytes.HasPrefix(code, minimalProxyPrefix) {
+		return implementation, false
+	}
+	code = code[len(minimalProxyPrefix):]
+	if len(code) == 0 || code[0] < opPush1 || code[0] > opPush1+19 {
+		return implementation, false
+	}
+	size := int(code[0]-opPush1) + 1
+	if len(code) < 1+size {
+		return implementation, false
+	}
+	address := code[1 : 1+size]
+	code = code[1+size:]
+	if !bytes.HasPrefix(code, minimalProxySuffix[0]) {
+		return implementation, false
+	}
+	code = code[len(minimalProxySuffix[0]):]
+	if len(code) != 1+len(minimalProxySuffix[1]) || !bytes.Equal(code[1:], minimalProxySuffix[1]) {
+		return implementation, false
+	}
+	copy(implementation[20-size:], address)
+	return implementation, true
+}
+
+// Delegates reports whether code has a DELEGATECALL, which every proxy has.
+func Delegates(code []byte) bool {
+	return bytes.IndexByte(Opcodes(StripMetadata(code)), opDelegateCall) >= 0
+}
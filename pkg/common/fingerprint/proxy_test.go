@@ -0,0 +1,41 @@
+package fingerprint
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fromHex(s string) []byte {
+	ret, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+func TestMinimalProxy(t *testing.T) {
+	implementation, ok := MinimalProxy(fromHex("363d3d373d3d3d363d73bebebebebebebebebebebebebebebebebebebebe5af43d82803e903d91602b57fd5bf3"))
+	assert.True(t, ok)
+	assert.Equal(t, [20]byte{0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe}, implementation)
+
+	// vanity address with 2 leading zero bytes
+	implementation, ok = MinimalProxy(fromHex("363d3d373d3d3d363d71bebebebebebebebebebebebebebebebebebe5af43d82803e903d91602957fd5bf3"))
+	assert.True(t, ok)
+	assert.Equal(t, [20]byte{0, 0, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe, 0xbe}, implementation)
+
+	// trailing code
+	_, ok = MinimalProxy(fromHex("363d3d373d3d3d363d73bebebebebebebebebebebebebebebebebebebebe5af43d82803e903d91602b57fd5bf300"))
+	assert.False(t, ok)
+	_, ok = MinimalProxy(fromHex("363d3d373d3d3d363d73bebe"))
+	assert.False(t, ok)
+	_, ok = MinimalProxy(nil)
+	assert.False(t, ok)
+}
+
+func TestDelegates(t *testing.T) {
+	assert.True(t, Delegates(fromHex("363d3d373d3d3d363d73bebebebebebebebebebebebebebebebebebebebe5af43d82803e903d91602b57fd5bf3")))
+	// 0xf4 as a PUSH operand
+	assert.False(t, Delegates(fromHex("60f400")))
+}
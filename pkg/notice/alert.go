@@ -0,0 +1,242 @@
+package notice
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// explorers are the block explorers of the chains alerts are linked to
+var explorers = map[string]string{
+	"bsc": "https://bscscan.com",
+	"eth": "https://etherscan.io",
+}
+
+// Alert is a structured message. Services only describe what happened, every
+// notice renders alerts on its own.
+type Alert struct {
+	// set on alerts to be acknowledged
+	ID       string    `json:"id,omitempty"`
+	Service  string    `json:"service"`
+	Severity Severity  `json:"severity"`
+	Title    string    `json:"title"`
+	Time     time.Time `json:"time"`
+	Chain    string    `json:"chain,omitempty"`
+	Block    uint64    `json:"block,omitempty"`
+	TxHash   string    `json:"tx_hash,omitempty"`
+	// token group the alert is about, alerts can be routed by it
+	Group     string    `json:"group,omitempty"`
+	Addresses []Address `json:"addresses,omitempty"`
+	Amounts   []Amount  `json:"amounts,omitempty"`
+	Tags      []Tag     `json:"tags,omitempty"`
+	Links     []Link    `json:"links,omitempty"`
+	// the event of the alert was reorged out of the chain
+	Retracted bool `json:"retracted"`
+	// notices mention everyone, e.g. for escalations
+	MentionAll bool `json:"mention_all,omitempty"`
+}
+
+// Address is an address involved in an alert, addresses with the same label
+// are shown together.
+type Address struct {
+	Label   string `json:"label"`
+	Address string `json:"address"`
+	// e.g. the symbol of a token, shown instead of the address
+	Name string `json:"name,omitempty"`
+	// defaults to the explorer page of the address
+	URL string `json:"url,omitempty"`
+}
+
+type Amount struct {
+	Label  string `json:"label"`
+	Value  string `json:"value"`
+	Symbol string `json:"symbol"`
+}
+
+type Tag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (a *Alert) String() string {
+	text := strings.Builder{}
+	text.WriteString(a.title())
+	for _, field := range a.Card().Fields {
+		items := make([]string, 0, len(field.Items))
+		for _, item := range field.Items {
+			items = append(items, item.Text)
+		}
+		text.WriteString(fmt.Sprintf(", %s: %s", Label(field.Name), strings.Join(items, " ")))
+	}
+	return text.String()
+}
+
+// Retract returns the follow-up of the alert for its event being reorged out.
+func (a *Alert) Retract() *Alert {
+	ret := *a
+	ret.Retracted = true
+	ret.Severity = SeverityInfo
+	return &ret
+}
+
+func (a *Alert) title() string {
+	if a.Retracted {
+		return Labelf("retracted", a.Title)
+	}
+	return a.Title
+}
+
+// TxURL returns the explorer page of the transaction, empty if unknown.
+func (a *Alert) TxURL() string {
+	if explorer, ok := explorers[a.Chain]; ok && a.TxHash != "" {
+		return explorer + "/tx/" + a.TxHash
+	}
+	return ""
+}
+
+// AddressURL returns the page of the address, empty if unknown.
+func (a *Alert) AddressURL(addr Address) string {
+	if addr.URL != "" {
+		return addr.URL
+	}
+	if explorer, ok := explorers[a.Chain]; ok {
+		return explorer + "/address/" + addr.Address
+	}
+	return ""
+}
+
+// Card lays the alert out as a card, fields follow the order of the id,
+// block, transaction, addresses, amounts, group, tags and links. Fields are
+// named by labels, to be translated with Label.
+func (a *Alert) Card() Card {
+	card := Card{
+		Title:    a.title(),
+		Severity: a.Severity,
+	}
+	if a.ID != "" {
+		card.Fields = append(card.Fields, CardField{Name: "alert_id", Items: []Link{{Text: a.ID}}})
+	}
+	if a.Block != 0 {
+		card.Fields = append(card.Fields, CardField{Name: "block", Items: []Link{{Text: fmt.Sprintf("%d", a.Block)}}})
+	}
+	if a.TxHash != "" {
+		card.Fields = append(card.Fields, CardField{Name: "tx_hash", Items: []Link{{Text: a.TxHash, URL: a.TxURL()}}})
+	}
+
+	labels := map[string]int{}
+	for _, addr := range a.Addresses {
+		text := addr.Name
+		if text == "" {
+			text = addr.Address
+		}
+		link := Link{Text: text, URL: a.AddressURL(addr)}
+		if i, ok := labels[addr.Label]; ok {
+			card.Fields[i].Items = append(card.Fields[i].Items, link)
+			continue
+		}
+		labels[addr.Label] = len(card.Fields)
+		card.Fields = append(card.Fields, CardField{Name: addr.Label, Items: []Link{link}})
+	}
+
+	for _, amount := range a.Amounts {
+		card.Fields = append(card.Fields, CardField{
+			Name:  amount.Label,
+			Items: []Link{{Text: strings.TrimSpace(amount.Value + " " + amount.Symbol)}},
+		})
+	}
+	if a.Group != "" {
+		card.Fields = append(card.Fields, CardField{Name: "group", Items: []Link{{Text: a.Group}}})
+	}
+	for _, tag := range a.Tags {
+		card.Fields = append(card.Fields, CardField{Name: tag.Name, Items: []Link{{Text: tag.Value}}})
+	}
+	if len(a.Links) > 0 {
+		card.Fields = append(card.Fields, CardField{Name: "links", Items: a.Links})
+	}
+	return card
+}
+
+// fieldValues returns the values of an alert field: service, severity, title,
+// chain, block, tx_hash, group, address, address:<label>, amount:<label> or
+// tag:<name>.
+func fieldValues(alert *Alert, field string) []string {
+	name, arg, _ := strings.Cut(field, ":")
+	var values []string
+	switch name {
+	case "service":
+		values = append(values, alert.Service)
+	case "severity":
+		values = append(values, alert.Severity.String())
+	case "title":
+		values = append(values, alert.Title)
+	case "chain":
+		values = append(values, alert.Chain)
+	case "block":
+		values = append(values, fmt.Sprint(alert.Block))
+	case "tx_hash":
+		values = append(values, alert.TxHash)
+	case "group":
+		values = append(values, alert.Group)
+	case "address":
+		for _, addr := range alert.Addresses {
+			if arg == "" || addr.Label == arg {
+				values = append(values, strings.ToLower(addr.Address))
+			}
+		}
+	case "amount":
+		for _, amount := range alert.Amounts {
+			if amount.Label == arg {
+				values = append(values, amount.Value+amount.Symbol)
+			}
+		}
+	case "tag":
+		for _, tag := range alert.Tags {
+			if tag.Name == arg {
+				values = append(values, tag.Value)
+			}
+		}
+	}
+	return values
+}
+
+// fieldLabel returns the text of the label of a field, e.g. of address:to, or
+// the field itself if it has none.
+func fieldLabel(field string) string {
+	if _, label, ok := strings.Cut(field, ":"); ok {
+		return Label(label)
+	}
+	return field
+}
+
+// summaryMsg is a message summarizing other alerts, produced by the notice
+// pipeline itself, which skips dedup and digests.
+type summaryMsg interface {
+	Msg
+	summarized() *Alert
+}
+
+// AlertOf returns msg as an alert of the service srv. Plain messages become
+// alerts with only a title.
+func AlertOf(msg Msg, srv any) *Alert {
+	var alert Alert
+	switch m := msg.(type) {
+	case *Alert:
+		alert = *m
+	case summaryMsg:
+		alert = *m.summarized()
+	case *RetractedMsg:
+		alert = *AlertOf(m.Msg, srv).Retract()
+	case *RoutedMsg:
+		alert = *AlertOf(m.Msg, srv)
+	default:
+		alert = Alert{
+			Severity: SeverityOf(msg),
+			Title:    msg.String(),
+			Time:     time.Now(),
+		}
+	}
+	if alert.Service == "" {
+		alert.Service = serviceName(srv)
+	}
+	return &alert
+}
@@ -0,0 +1,90 @@
+package notice
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestAlert(t *testing.T) {
+	suite.Run(t, new(AlertTestSuite))
+}
+
+type DummyService string
+
+func (d DummyService) Name() string {
+	return string(d)
+}
+
+func testAlert() *Alert {
+	return &Alert{
+		Service:  "transfer",
+		Severity: SeverityCritical,
+		Title:    "交易捕获: 1.5 USDT",
+		Time:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Chain:    "bsc",
+		TxHash:   "0x01",
+		Addresses: []Address{
+			{Label: "发款方", Address: "0xa"},
+			{Label: "关联币种", Address: "0xb", Name: "AAA", URL: "https://ave.ai/token/0xb-bsc"},
+			{Label: "关联币种", Address: "0xc", Name: "BBB", URL: "https://ave.ai/token/0xc-bsc"},
+		},
+		Amounts: []Amount{{Label: "金额", Value: "1.5", Symbol: "USDT"}},
+		Tags:    []Tag{{Name: "分组", Value: "meme"}},
+	}
+}
+
+type AlertTestSuite struct {
+	suite.Suite
+}
+
+func (s *AlertTestSuite) TestCard() {
+	card := testAlert().Card()
+	s.Equal("交易捕获: 1.5 USDT", card.Title)
+	s.Equal(SeverityCritical, card.Severity)
+	s.Equal([]CardField{
+		{Name: "tx_hash", Items: []Link{{Text: "0x01", URL: "https://bscscan.com/tx/0x01"}}},
+		{Name: "发款方", Items: []Link{{Text: "0xa", URL: "https://bscscan.com/address/0xa"}}},
+		{Name: "关联币种", Items: []Link{
+			{Text: "AAA", URL: "https://ave.ai/token/0xb-bsc"},
+			{Text: "BBB", URL: "https://ave.ai/token/0xc-bsc"},
+		}},
+		{Name: "金额", Items: []Link{{Text: "1.5 USDT"}}},
+		{Name: "分组", Items: []Link{{Text: "meme"}}},
+	}, card.Fields)
+}
+
+func (s *AlertTestSuite) TestString() {
+	s.Equal("交易捕获: 1.5 USDT, Tx Hash: 0x01, 发款方: 0xa, 关联币种: AAA BBB, 金额: 1.5 USDT, 分组: meme",
+		testAlert().String())
+}
+
+func (s *AlertTestSuite) TestRetract() {
+	alert := testAlert()
+	retracted := alert.Retract()
+	s.False(alert.Retracted)
+	s.True(retracted.Retracted)
+	s.Equal(SeverityInfo, retracted.Severity)
+	s.Equal("[已回滚] 交易捕获: 1.5 USDT", retracted.Card().Title)
+}
+
+func (s *AlertTestSuite) TestAlertOf() {
+	alert := AlertOf(TextMsg("msg"), DummyService("constructor"))
+	s.Equal("constructor", alert.Service)
+	s.Equal("msg", alert.Title)
+	s.Equal(SeverityInfo, alert.Severity)
+
+	alert = AlertOf(&RetractedMsg{Msg: testAlert()}, DummyService("constructor"))
+	s.Equal("transfer", alert.Service)
+	s.True(alert.Retracted)
+}
+
+func (s *AlertTestSuite) TestJSON() {
+	data, err := json.Marshal(testAlert())
+	s.NoError(err)
+	s.Contains(string(data), `"severity":"critical"`)
+	s.Contains(string(data), `"tx_hash":"0x01"`)
+	s.Contains(string(data), `"amounts":[{"label":"金额","value":"1.5","symbol":"USDT"}]`)
+}
@@ -0,0 +1,45 @@
+package notice
+
+// Card is a message laid out as a title and named fields, rendered by the
+// rich webhook notices such as Slack and Discord.
+type Card struct {
+	Title    string
+	Severity Severity
+	Fields   []CardField
+}
+
+type CardField struct {
+	Name  string
+	Items []Link
+}
+
+// Link is shown as plain text if URL is empty.
+type Link struct {
+	Text string `json:"text"`
+	URL  string `json:"url,omitempty"`
+}
+
+// Webhooks maps service names to webhook urls, "default" for services not
+// listed.
+type Webhooks map[string]string
+
+func (w Webhooks) Of(service string) string {
+	if url, ok := w[service]; ok {
+		return url
+	}
+	return w["default"]
+}
+
+// severityColors are RGB colors of the severities
+var severityColors = map[Severity]int{
+	SeverityInfo:     0x439FE0,
+	SeverityWarning:  0xFFA500,
+	SeverityCritical: 0xE01E5A,
+}
+
+func colorOf(s Severity) int {
+	if color, ok := severityColors[s]; ok {
+		return color
+	}
+	return severityColors[SeverityInfo]
+}
@@ -0,0 +1,196 @@
+package notice
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	DefaultDigestTop      = 5
+	DefaultDigestCurrency = "USDT"
+
+	// DigestService is the service name digests are sent as, so they can
+	// have templates and routes of their own
+	DigestService = "digest"
+)
+
+// DigestConfig accumulates alerts up to Severity and sends them as a single
+// summary every Interval, more severe alerts still go out immediately.
+type DigestConfig struct {
+	// digests are disabled if zero
+	Interval time.Duration `koanf:"interval"`
+	Severity Severity      `koanf:"severity"`
+	// number of alerts of the highest value listed
+	Top int `koanf:"top"`
+	// the currency amounts are valued in
+	Currency string `koanf:"currency"`
+	// alert fields totals are grouped by, e.g. address:to or group
+	GroupBy []string `koanf:"group_by"`
+}
+
+// DigestMsg summarizes the alerts accumulated over an interval.
+type DigestMsg struct {
+	*Alert
+	Alerts []*Alert
+}
+
+func (m *DigestMsg) summarized() *Alert {
+	return m.Alert
+}
+
+type digestTotal struct {
+	// the label of the field and the value, e.g. "To 0xa"
+	name  string
+	count int
+	value decimal.Decimal
+}
+
+// Digest accumulates low severity alerts.
+type Digest struct {
+	cfg DigestConfig
+
+	mu     sync.Mutex
+	alerts []*Alert
+	start  time.Time
+	timer  *time.Timer
+}
+
+func NewDigest(cfg DigestConfig) *Digest {
+	if cfg.Top <= 0 {
+		cfg.Top = DefaultDigestTop
+	}
+	if cfg.Currency == "" {
+		cfg.Currency = DefaultDigestCurrency
+	}
+	return &Digest{cfg: cfg}
+}
+
+// Add accumulates the message if it is to be digested, the digest is sent
+// through broadcast at the end of the interval.
+func (d *Digest) Add(msg Msg, srv any, broadcast func(msg Msg, srv any)) bool {
+	if d.cfg.Interval <= 0 {
+		return false
+	}
+	if _, ok := msg.(summaryMsg); ok {
+		return false
+	}
+	alert := AlertOf(msg, srv)
+	if alert.Severity > d.cfg.Severity {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.alerts) == 0 {
+		d.start = time.Now()
+		d.timer = time.AfterFunc(d.cfg.Interval, func() {
+			if digest := d.take(); digest != nil {
+				broadcast(digest, nil)
+			}
+		})
+	}
+	d.alerts = append(d.alerts, alert)
+	return true
+}
+
+// take returns the digest of the accumulated alerts and starts over, nil if
+// there are none.
+func (d *Digest) take() *DigestMsg {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.alerts) == 0 {
+		return nil
+	}
+	digest := d.summarize(d.alerts, d.start, time.Now())
+	d.alerts = nil
+	return digest
+}
+
+// Flush sends the accumulated alerts right away.
+func (d *Digest) Flush(broadcast func(msg Msg, srv any)) {
+	d.mu.Lock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.mu.Unlock()
+	if digest := d.take(); digest != nil {
+		broadcast(digest, nil)
+	}
+}
+
+// value returns the amounts of the alert in the digest currency.
+func (d *Digest) value(alert *Alert) decimal.Decimal {
+	ret := decimal.Zero
+	for _, amount := range alert.Amounts {
+		if amount.Symbol != d.cfg.Currency {
+			continue
+		}
+		if v, err := decimal.NewFromString(amount.Value); err == nil {
+			ret = ret.Add(v)
+		}
+	}
+	return ret
+}
+
+func (d *Digest) summarize(alerts []*Alert, start time.Time, end time.Time) *DigestMsg {
+	summary := &Alert{
+		Service: DigestService,
+		Title: Labelf("digest_title",
+			start.Format(time.DateTime), end.Format(time.DateTime), len(alerts)),
+		Time: end,
+	}
+
+	var services []string
+	counts := map[string]int{}
+	var groups []string
+	totals := map[string]*digestTotal{}
+	for _, alert := range alerts {
+		if alert.Severity > summary.Severity {
+			summary.Severity = alert.Severity
+		}
+		if _, ok := counts[alert.Service]; !ok {
+			services = append(services, alert.Service)
+		}
+		counts[alert.Service]++
+
+		for _, field := range d.cfg.GroupBy {
+			for _, value := range fieldValues(alert, field) {
+				key := field + " " + value
+				total, ok := totals[key]
+				if !ok {
+					groups = append(groups, key)
+					total = &digestTotal{name: fieldLabel(field) + " " + value, value: decimal.Zero}
+					totals[key] = total
+				}
+				total.count++
+				total.value = total.value.Add(d.value(alert))
+			}
+		}
+	}
+
+	for _, service := range services {
+		summary.Tags = append(summary.Tags, Tag{Name: service, Value: Labelf("digest_count", counts[service])})
+	}
+	for _, group := range groups {
+		total := totals[group]
+		summary.Tags = append(summary.Tags, Tag{
+			Name:  total.name,
+			Value: Labelf("digest_total", total.count, total.value.StringFixed(2), d.cfg.Currency),
+		})
+	}
+
+	top := append([]*Alert(nil), alerts...)
+	sort.SliceStable(top, func(i, j int) bool {
+		return d.value(top[i]).GreaterThan(d.value(top[j]))
+	})
+	if len(top) > d.cfg.Top {
+		top = top[:d.cfg.Top]
+	}
+	for _, alert := range top {
+		summary.Links = append(summary.Links, Link{Text: alert.title(), URL: alert.TxURL()})
+	}
+	return &DigestMsg{Alert: summary, Alerts: alerts}
+}
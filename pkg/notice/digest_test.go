@@ -0,0 +1,85 @@
+package notice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestDigest(t *testing.T) {
+	suite.Run(t, new(DigestTestSuite))
+}
+
+type DigestTestSuite struct {
+	suite.Suite
+
+	notice *RecordingNotice
+}
+
+func (s *DigestTestSuite) SetupTest() {
+	s.notice = &RecordingNotice{}
+}
+
+func (s *DigestTestSuite) broadcast(msg Msg, srv any) {
+	_ = s.notice.Notice(msg, srv)
+}
+
+func (s *DigestTestSuite) alert(severity Severity, to string, value string) *Alert {
+	alert := testAlert()
+	alert.Severity = severity
+	alert.TxHash = "0x" + value
+	alert.Addresses = []Address{{Label: "收款方", Address: to}}
+	alert.Amounts = []Amount{{Label: "金额", Value: value, Symbol: "USDT"}}
+	return alert
+}
+
+func (s *DigestTestSuite) TestSeverity() {
+	d := NewDigest(DigestConfig{Interval: time.Minute, Severity: SeverityWarning})
+	s.True(d.Add(s.alert(SeverityInfo, "0xa", "1"), nil, s.broadcast))
+	s.True(d.Add(s.alert(SeverityWarning, "0xa", "1"), nil, s.broadcast))
+	s.False(d.Add(s.alert(SeverityCritical, "0xa", "1"), nil, s.broadcast))
+	s.False(NewDigest(DigestConfig{}).Add(s.alert(SeverityInfo, "0xa", "1"), nil, s.broadcast))
+}
+
+func (s *DigestTestSuite) TestInterval() {
+	d := NewDigest(DigestConfig{Interval: 50 * time.Millisecond})
+	s.True(d.Add(s.alert(SeverityInfo, "0xa", "1"), nil, s.broadcast))
+	s.True(d.Add(TextMsg("msg"), DummyService("constructor"), s.broadcast))
+
+	s.Eventually(func() bool { return len(s.notice.Msgs()) == 1 }, time.Second, 10*time.Millisecond)
+	digest := s.notice.Msgs()[0].(*DigestMsg)
+	s.Len(digest.Alerts, 2)
+	s.Equal(DigestService, digest.Service)
+	s.False(d.Add(digest, nil, s.broadcast))
+
+	// the next alert starts a new interval
+	s.True(d.Add(s.alert(SeverityInfo, "0xa", "1"), nil, s.broadcast))
+	s.Eventually(func() bool { return len(s.notice.Msgs()) == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func (s *DigestTestSuite) TestSummary() {
+	d := NewDigest(DigestConfig{Interval: time.Minute, Top: 2, GroupBy: []string{"address:收款方"}})
+	s.True(d.Add(s.alert(SeverityInfo, "0xa", "100"), nil, s.broadcast))
+	s.True(d.Add(s.alert(SeverityInfo, "0xb", "300"), nil, s.broadcast))
+	s.True(d.Add(s.alert(SeverityInfo, "0xA", "200.5"), nil, s.broadcast))
+	s.True(d.Add(TextMsg("msg"), DummyService("constructor"), s.broadcast))
+
+	d.Flush(s.broadcast)
+	s.Len(s.notice.Msgs(), 1)
+	digest := s.notice.Msgs()[0].(*DigestMsg)
+	s.Contains(digest.Title, "共 4 条")
+	s.Equal([]Tag{
+		{Name: "transfer", Value: "3 条"},
+		{Name: "constructor", Value: "1 条"},
+		{Name: "收款方 0xa", Value: "2 条, 300.50 USDT"},
+		{Name: "收款方 0xb", Value: "1 条, 300.00 USDT"},
+	}, digest.Tags)
+	s.Equal([]Link{
+		{Text: "交易捕获: 1.5 USDT", URL: "https://bscscan.com/tx/0x300"},
+		{Text: "交易捕获: 1.5 USDT", URL: "https://bscscan.com/tx/0x200.5"},
+	}, digest.Links)
+
+	d.Flush(s.broadcast)
+	s.Len(s.notice.Msgs(), 1)
+}
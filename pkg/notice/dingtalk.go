@@ -2,43 +2,188 @@ package notice
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
-const DingtalkUrl = "https://oapi.dingtalk.com/robot/send?access_token=%s"
+const DingtalkUrl = "https://oapi.dingtalk.com/robot/send"
 
-type Dingtalk struct{}
+// DingtalkErrSecurity is the errcode of messages rejected by the keyword, ip
+// or signature settings of the robot, which no retry can fix
+const DingtalkErrSecurity = 310000
 
-func (d Dingtalk) Notice(msg Msg, srv any) error {
-	if sender, ok := srv.(DingtalkNotifier); ok {
-		token, content := sender.DingtalkMsg(msg)
-		resp, err := http.Post(fmt.Sprintf(DingtalkUrl, token), "application/json", bytes.NewBuffer([]byte(content)))
-		if err != nil {
-			return err
-		}
+var httpClient = &http.Client{Timeout: 10 * time.Second}
 
-		defer func() {
-			_ = resp.Body.Close()
-		}()
+type DingtalkConfig struct {
+	BaseURL string `koanf:"base_url"`
+	// access token of the robot, the top level dingtalk_token if empty
+	Token string `koanf:"token"`
+	// secret of robots in the signed ("加签") security mode
+	Secret string `koanf:"secret"`
+	// service name -> mentions, "default" for services not listed
+	Mentions map[string][]DingtalkMention `koanf:"mentions"`
+}
 
-		var data map[string]interface{}
-		if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-			return err
-		}
-		if data["errcode"].(float64) != 0 {
-			return errors.New(data["errmsg"].(string))
+// DingtalkMention mentions people in messages of at least Severity.
+type DingtalkMention struct {
+	Severity Severity `koanf:"severity"`
+	Mobiles  []string `koanf:"mobiles"`
+	UserIds  []string `koanf:"user_ids"`
+	All      bool     `koanf:"all"`
+}
+
+// MentionsOf merges the mentions of the service which apply to severity.
+func (c DingtalkConfig) MentionsOf(service string, severity Severity) DingtalkAt {
+	mentions, ok := c.Mentions[service]
+	if !ok {
+		mentions = c.Mentions["default"]
+	}
+
+	at := DingtalkAt{AtMobiles: []string{}, AtUserIds: []string{}}
+	for _, m := range mentions {
+		if severity < m.Severity {
+			continue
 		}
+		at.AtMobiles = append(at.AtMobiles, m.Mobiles...)
+		at.AtUserIds = append(at.AtUserIds, m.UserIds...)
+		at.IsAtAll = at.IsAtAll || m.All
 	}
-	return nil
+	return at
+}
+
+type Dingtalk struct {
+	cfg DingtalkConfig
+}
+
+var dingtalkDialect = dialect{
+	escape: func(text string) string {
+		return text
+	},
+	link: func(text string, url string) string {
+		return fmt.Sprintf("[%s](%s)", text, url)
+	},
+	heading: func(text string) string {
+		return "### " + text
+	},
 }
 
-type DingtalkNotifier interface {
-	DingtalkMsg(msg Msg) (token string, content string)
+type DingtalkAt struct {
+	AtMobiles []string `json:"atMobiles"`
+	AtUserIds []string `json:"atUserIds"`
+	IsAtAll   bool     `json:"isAtAll"`
+}
+
+type dingtalkMarkdown struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+type dingtalkReq struct {
+	MsgType  string           `json:"msgtype"`
+	Markdown dingtalkMarkdown `json:"markdown"`
+	At       DingtalkAt       `json:"at"`
+}
+
+type dingtalkResp struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (d *Dingtalk) Name() string {
+	return "dingtalk"
+}
+
+func (d *Dingtalk) Configure(cfg Config) {
+	d.cfg = cfg.Dingtalk
+}
+
+// sign computes the signature of signed robots, the base64 encoded
+// HMAC-SHA256 of "timestamp\nsecret" keyed by the secret.
+func sign(timestamp int64, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d\n%s", timestamp, secret)))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dingtalk) url(token string, secret string) string {
+	base := d.cfg.BaseURL
+	if base == "" {
+		base = DingtalkUrl
+	}
+	query := url.Values{"access_token": {token}}
+	if secret != "" {
+		timestamp := time.Now().UnixMilli()
+		query.Set("timestamp", strconv.FormatInt(timestamp, 10))
+		query.Set("sign", sign(timestamp, secret))
+	}
+	return base + "?" + query.Encode()
+}
+
+// Notice sends to the robot of the channel the message is routed to, the
+// configured robot otherwise.
+func (d *Dingtalk) Notice(msg Msg, srv any) error {
+	token, secret := d.cfg.Token, d.cfg.Secret
+	if channel, ok := ChannelOf(msg); ok {
+		token, secret = channel.Token, channel.Secret
+	}
+	if token == "" {
+		return nil
+	}
+	alert := AlertOf(msg, srv)
+	text, err := templates.render(alert, d.Name(), dingtalkDialect)
+	if err != nil {
+		return Permanent(err)
+	}
+	req := dingtalkReq{
+		MsgType:  "markdown",
+		Markdown: dingtalkMarkdown{Title: alert.title(), Text: text},
+		At:       d.cfg.MentionsOf(alert.Service, alert.Severity),
+	}
+	req.At.IsAtAll = req.At.IsAtAll || alert.MentionAll
+	// mobiles and user ids are only highlighted if mentioned in the text
+	var mentions []string
+	for _, id := range append(req.At.AtMobiles, req.At.AtUserIds...) {
+		mentions = append(mentions, "@"+id)
+	}
+	if len(mentions) > 0 {
+		req.Markdown.Text = strings.TrimSpace(req.Markdown.Text + "\n\n" + strings.Join(mentions, " "))
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Permanent(err)
+	}
+	resp, err := httpClient.Post(d.url(token, secret), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var data dingtalkResp
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return err
+	}
+	if data.ErrCode != 0 {
+		err := fmt.Errorf("dingtalk errcode %d: %s", data.ErrCode, data.ErrMsg)
+		if data.ErrCode == DingtalkErrSecurity {
+			return Permanent(err)
+		}
+		return err
+	}
+	return nil
 }
 
 func init() {
-	RegisterNotice(Dingtalk{})
+	RegisterNotice(&Dingtalk{})
 }
@@ -0,0 +1,119 @@
+package notice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestDingtalk(t *testing.T) {
+	suite.Run(t, new(DingtalkTestSuite))
+}
+
+type DingtalkTestSuite struct {
+	suite.Suite
+
+	server   *httptest.Server
+	query    url.Values
+	req      dingtalkReq
+	response string
+	dingtalk *Dingtalk
+}
+
+func (s *DingtalkTestSuite) SetupTest() {
+	s.query = nil
+	s.req = dingtalkReq{}
+	s.response = `{"errcode":0,"errmsg":"ok"}`
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.query = r.URL.Query()
+		s.NoError(json.NewDecoder(r.Body).Decode(&s.req))
+		_, _ = w.Write([]byte(s.response))
+	}))
+
+	s.dingtalk = &Dingtalk{}
+	s.dingtalk.Configure(Config{
+		Dingtalk: DingtalkConfig{
+			BaseURL: s.server.URL,
+			Token:   "token",
+			Mentions: map[string][]DingtalkMention{
+				"transfer": {
+					{Severity: SeverityInfo, UserIds: []string{"ops"}},
+					{Severity: SeverityCritical, Mobiles: []string{"13800000000"}, All: true},
+				},
+			},
+		},
+	})
+}
+
+func (s *DingtalkTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *DingtalkTestSuite) TestNotice() {
+	s.NoError(s.dingtalk.Notice(TextMsg("a \"quoted\"\nmessage"), DummyService("transfer")))
+	s.Equal("token", s.query.Get("access_token"))
+	s.Empty(s.query.Get("sign"))
+	s.Equal("markdown", s.req.MsgType)
+	s.Equal("a \"quoted\"\nmessage", s.req.Markdown.Title)
+	s.Equal("@ops", s.req.Markdown.Text)
+	s.Equal([]string{"ops"}, s.req.At.AtUserIds)
+	s.Empty(s.req.At.AtMobiles)
+	s.False(s.req.At.IsAtAll)
+}
+
+func (s *DingtalkTestSuite) TestMarkdown() {
+	alert := testAlert()
+	alert.Service = "constructor"
+	s.NoError(s.dingtalk.Notice(alert, nil))
+	s.Equal("### Tx Hash\n[0x01](https://bscscan.com/tx/0x01)\n"+
+		"\n### 发款方\n[0xa](https://bscscan.com/address/0xa)\n"+
+		"\n### 关联币种\n[AAA](https://ave.ai/token/0xb-bsc)\n[BBB](https://ave.ai/token/0xc-bsc)\n"+
+		"\n### 金额\n1.5 USDT\n"+
+		"\n### 分组\nmeme", s.req.Markdown.Text)
+}
+
+func (s *DingtalkTestSuite) TestMentionsBySeverity() {
+	s.NoError(s.dingtalk.Notice(testAlert(), nil))
+	s.Equal([]string{"13800000000"}, s.req.At.AtMobiles)
+	s.Equal([]string{"ops"}, s.req.At.AtUserIds)
+	s.True(s.req.At.IsAtAll)
+	s.True(strings.HasSuffix(s.req.Markdown.Text, "\n@13800000000 @ops"))
+}
+
+func (s *DingtalkTestSuite) TestMentionAll() {
+	alert := testAlert()
+	alert.Service = "constructor"
+	alert.MentionAll = true
+	s.NoError(s.dingtalk.Notice(alert, nil))
+	s.True(s.req.At.IsAtAll)
+}
+
+func (s *DingtalkTestSuite) TestSign() {
+	s.dingtalk.cfg.Secret = "SEC123"
+	s.NoError(s.dingtalk.Notice(TextMsg("msg"), nil))
+
+	timestamp, err := strconv.ParseInt(s.query.Get("timestamp"), 10, 64)
+	s.NoError(err)
+	s.Equal(sign(timestamp, "SEC123"), s.query.Get("sign"))
+	s.Equal("lkcPI1uoxBY1gUnCnnPH1Kkru0Hqjo7rFpA3haIVhEQ=", sign(1700000000000, "SEC123"))
+}
+
+func (s *DingtalkTestSuite) TestChannel() {
+	msg := &RoutedMsg{Msg: TextMsg("msg"), ChannelName: "group-a", Channel: Channel{Token: "group-a", Secret: "SEC123"}}
+	s.NoError(s.dingtalk.Notice(msg, nil))
+	s.Equal("group-a", s.query.Get("access_token"))
+	s.NotEmpty(s.query.Get("sign"))
+}
+
+func (s *DingtalkTestSuite) TestSecurityError() {
+	s.response = `{"errcode":310000,"errmsg":"sign not match"}`
+	err := s.dingtalk.Notice(TextMsg("msg"), nil)
+	s.Error(err)
+	s.True(IsPermanent(err))
+}
@@ -0,0 +1,150 @@
+package notice
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DiscordMaxWait bounds the wait for an exhausted rate limit bucket
+	DiscordMaxWait = 30 * time.Second
+)
+
+type DiscordConfig struct {
+	Webhooks Webhooks `koanf:"webhooks"`
+}
+
+// Discord posts embeds to webhooks. It follows the X-RateLimit headers, so
+// an exhausted bucket is waited for instead of running into 429s.
+type Discord struct {
+	cfg DiscordConfig
+	mu  sync.Mutex
+	// webhook -> time the rate limit bucket resets
+	resetAt map[string]time.Time
+}
+
+var discordEscaper = strings.NewReplacer("[", "\\[", "]", "\\]", "*", "\\*", "_", "\\_", "`", "\\`")
+
+var discordDialect = dialect{
+	escape: discordEscaper.Replace,
+	link: func(text string, url string) string {
+		return fmt.Sprintf("[%s](%s)", discordEscaper.Replace(text), url)
+	},
+	heading: func(text string) string {
+		return "**" + discordEscaper.Replace(text) + "**"
+	},
+}
+
+func (d *Discord) Name() string {
+	return "discord"
+}
+
+func (d *Discord) Configure(cfg Config) {
+	d.cfg = cfg.Discord
+}
+
+func (d *Discord) Notice(msg Msg, srv any) error {
+	alert := AlertOf(msg, srv)
+	webhook := d.cfg.Webhooks.Of(alert.Service)
+	if channel, ok := ChannelOf(msg); ok {
+		webhook = channel.Webhook
+	}
+	if webhook == "" {
+		return nil
+	}
+	text, err := templates.render(alert, d.Name(), discordDialect)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	body, err := json.Marshal(d.payload(alert, text))
+	if err != nil {
+		return Permanent(err)
+	}
+
+	d.waitBucket(webhook)
+	resp, err := httpClient.Post(webhook, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	d.updateBucket(webhook, resp.Header)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("discord status %d: %s", resp.StatusCode, content)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		var data struct {
+			RetryAfter float64 `json:"retry_after"`
+		}
+		after := retryAfterHeader(resp.Header)
+		if json.Unmarshal(content, &data) == nil && data.RetryAfter > 0 {
+			after = time.Duration(data.RetryAfter * float64(time.Second))
+		}
+		return RetryAfter(err, after)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return Permanent(err)
+	default:
+		return err
+	}
+}
+
+func (d *Discord) waitBucket(webhook string) {
+	d.mu.Lock()
+	wait := time.Until(d.resetAt[webhook])
+	d.mu.Unlock()
+	if wait > DiscordMaxWait {
+		wait = DiscordMaxWait
+	}
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+func (d *Discord) updateBucket(webhook string, header http.Header) {
+	if header.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+	seconds, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64)
+	if err != nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.resetAt == nil {
+		d.resetAt = map[string]time.Time{}
+	}
+	d.resetAt[webhook] = time.Now().Add(time.Duration(seconds * float64(time.Second)))
+}
+
+func (d *Discord) payload(alert *Alert, text string) map[string]any {
+	payload := map[string]any{
+		"embeds": []map[string]any{{
+			"title":       alert.title(),
+			"description": text,
+			"color":       colorOf(alert.Severity),
+			"timestamp":   alert.Time.Format(time.RFC3339),
+		}},
+	}
+	if alert.MentionAll {
+		payload["content"] = "@everyone"
+		payload["allowed_mentions"] = map[string]any{"parse": []string{"everyone"}}
+	}
+	return payload
+}
+
+func init() {
+	RegisterNotice(&Discord{})
+}
@@ -0,0 +1,74 @@
+package notice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestDiscord(t *testing.T) {
+	suite.Run(t, new(DiscordTestSuite))
+}
+
+type DiscordTestSuite struct {
+	suite.Suite
+
+	server   *httptest.Server
+	payload  map[string]any
+	status   int
+	response string
+	header   http.Header
+	discord  *Discord
+}
+
+func (s *DiscordTestSuite) SetupTest() {
+	s.payload = nil
+	s.status = http.StatusNoContent
+	s.response = ""
+	s.header = http.Header{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.NoError(json.NewDecoder(r.Body).Decode(&s.payload))
+		for k, v := range s.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(s.status)
+		_, _ = w.Write([]byte(s.response))
+	}))
+	s.discord = &Discord{}
+	s.discord.Configure(Config{Discord: DiscordConfig{Webhooks: Webhooks{"default": s.server.URL}}})
+}
+
+func (s *DiscordTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *DiscordTestSuite) TestNotice() {
+	s.NoError(s.discord.Notice(testAlert(), nil))
+
+	embed := s.payload["embeds"].([]any)[0].(map[string]any)
+	s.Equal("交易捕获: 1.5 USDT", embed["title"])
+	s.Equal(float64(0xE01E5A), embed["color"])
+	s.True(strings.HasPrefix(embed["description"].(string), "**Tx Hash**\n[0x01](https://bscscan.com/tx/0x01)\n"))
+}
+
+func (s *DiscordTestSuite) TestRateLimited() {
+	s.status = http.StatusTooManyRequests
+	s.response = `{"message": "You are being rate limited.", "retry_after": 1.5, "global": false}`
+	err := s.discord.Notice(testAlert(), nil)
+	s.Equal(1500*time.Millisecond, retryAfterOf(err))
+}
+
+func (s *DiscordTestSuite) TestWaitExhaustedBucket() {
+	s.header.Set("X-RateLimit-Remaining", "0")
+	s.header.Set("X-RateLimit-Reset-After", "0.2")
+	s.NoError(s.discord.Notice(TextMsg("1"), nil))
+
+	start := time.Now()
+	s.NoError(s.discord.Notice(TextMsg("2"), nil))
+	s.GreaterOrEqual(time.Since(start), 150*time.Millisecond)
+}
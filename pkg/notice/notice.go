@@ -1,6 +1,20 @@
 package notice
 
-var notices []Notice
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	notices []Notice
+	// throttle of the broadcasts, nil if not set up
+	throttle *Throttle
+	// digest of low severity alerts, nil if not set up
+	digest *Digest
+	// router of the alerts to channels, nil if not set up
+	router *Router
+	// quiet hours and escalations, nil if not set up
+	policy *Policy
+)
 
 type Notice interface {
 	Notice(msg Msg, srv any) error
@@ -15,13 +29,168 @@ func (m TextMsg) String() string {
 	return string(m)
 }
 
+// RetractedMsg follows up a message whose event was reorged out of the chain.
+type RetractedMsg struct {
+	Msg
+}
+
+func (m *RetractedMsg) String() string {
+	return Labelf("retracted", m.Msg.String())
+}
+
+type Config struct {
+	Outbox   OutboxConfig   `koanf:"outbox"`
+	Dingtalk DingtalkConfig `koanf:"dingtalk"`
+	Telegram TelegramConfig `koanf:"telegram"`
+	Slack    SlackConfig    `koanf:"slack"`
+	Discord  DiscordConfig  `koanf:"discord"`
+	Webhook  WebhookConfig  `koanf:"webhook"`
+	Template TemplateConfig `koanf:"template"`
+	Throttle ThrottleConfig `koanf:"throttle"`
+	Digest   DigestConfig   `koanf:"digest"`
+	// channel name -> channel, named destinations of the notices
+	Channels map[string]Channel `koanf:"channels"`
+	// alerts go to the channels of every matching route, or to every notice
+	// if there are no routes
+	Routes []Route      `koanf:"routes"`
+	Policy PolicyConfig `koanf:"policy"`
+}
+
+// configurable notices take their settings from the notice config.
+type configurable interface {
+	Configure(cfg Config)
+}
+
 func RegisterNotice(n Notice) {
 	notices = append(notices, n)
 }
 
+// Setup configures every registered notice and puts it behind an outbox, so
+// broadcasting no longer waits for deliveries.
+func Setup(cfg Config) {
+	templates = newTemplateSet(cfg.Template)
+	throttle = NewThrottle(cfg.Throttle)
+	digest = NewDigest(cfg.Digest)
+	router = NewRouter(cfg.Routes, cfg.Channels)
+	policy = NewPolicy(cfg.Policy)
+	deadLetter := NewDeadLetter(cfg.Outbox.DeadLetterFile)
+	for i, n := range notices {
+		if _, ok := n.(*Outbox); ok {
+			continue
+		}
+		if c, ok := n.(configurable); ok {
+			c.Configure(cfg)
+		}
+		notices[i] = NewOutbox(n, cfg.Outbox, deadLetter)
+	}
+	for name, channel := range cfg.Channels {
+		if findNotice(channel.Notice) == nil {
+			log.Errorf("channel %s of unknown notice %s", name, channel.Notice)
+		}
+	}
+	for _, name := range cfg.Policy.Escalation.Channels {
+		if _, ok := cfg.Channels[name]; !ok {
+			log.Errorf("escalation to unknown channel %s", name)
+		}
+	}
+	policy.Serve()
+}
+
+func findNotice(name string) Notice {
+	for _, n := range notices {
+		if noticeName(n) == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// Close sends the pending digest and summaries of suppressed alerts, then
+// waits until the queued messages of every outbox are handled.
+func Close() {
+	if policy != nil {
+		policy.Close()
+	}
+	if digest != nil {
+		digest.Flush(broadcast)
+	}
+	if throttle != nil {
+		throttle.Flush(broadcast)
+	}
+	for _, n := range notices {
+		if o, ok := n.(*Outbox); ok {
+			o.Close()
+		}
+	}
+}
+
+// Metrics returns the delivery metrics of every outbox by notice name.
+func Metrics() map[string]OutboxMetrics {
+	ret := map[string]OutboxMetrics{}
+	for _, n := range notices {
+		if o, ok := n.(*Outbox); ok {
+			ret[o.name] = o.Metrics()
+		}
+	}
+	return ret
+}
+
 //go:noinline
 func BroadCast(msg Msg, srv any) {
+	if throttle != nil && !throttle.Admit(msg, srv, broadcast) {
+		return
+	}
+	if digest != nil && digest.Add(msg, srv, broadcast) {
+		return
+	}
+	if policy != nil {
+		msg = policy.Track(msg, srv, escalate)
+	}
+	broadcast(msg, srv)
+}
+
+// escalate sends an unacknowledged alert to the escalation channels, or
+// broadcasts it again if there are none.
+func escalate(msg Msg, srv any) {
+	channels := policy.cfg.Escalation.Channels
+	if len(channels) == 0 {
+		broadcast(msg, srv)
+		return
+	}
+	for _, name := range channels {
+		deliver(name, msg, srv)
+	}
+}
+
+// deliver sends msg to the channel unless the policy or throttle holds it
+// back.
+func deliver(name string, msg Msg, srv any) {
+	channel := router.Channel(name)
+	n := findNotice(channel.Notice)
+	if n == nil {
+		return
+	}
+	send(n, &RoutedMsg{Msg: msg, ChannelName: name, Channel: channel}, srv)
+}
+
+func send(n Notice, msg Msg, srv any) {
+	if policy != nil && !policy.Allow(n, msg, srv) {
+		return
+	}
+	if throttle != nil && !throttle.Allow(n, msg, srv) {
+		return
+	}
+	n.Notice(msg, srv)
+}
+
+func broadcast(msg Msg, srv any) {
+	if router != nil && router.Enabled() {
+		for _, name := range router.Route(AlertOf(msg, srv)) {
+			deliver(name, msg, srv)
+		}
+		return
+	}
 	for _, n := range notices {
-		n.Notice(msg, srv)
+		send(n, msg, srv)
 	}
 }
@@ -0,0 +1,403 @@
+package notice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultQueueSize       = 256
+	DefaultWorkers         = 2
+	DefaultRetryCnt        = 5
+	DefaultRetryBackOff    = time.Second
+	DefaultRetryBackOffMax = time.Minute
+)
+
+var (
+	ErrQueueFull    = errors.New("notice queue is full")
+	ErrOutboxClosed = errors.New("notice outbox is closed")
+)
+
+type OutboxConfig struct {
+	QueueSize       int           `koanf:"queue_size"`
+	Workers         int           `koanf:"workers"`
+	RetryCnt        int           `koanf:"retry_cnt"`
+	RetryBackOff    time.Duration `koanf:"retry_backoff"`
+	RetryBackOffMax time.Duration `koanf:"retry_backoff_max"`
+	DeadLetterFile  string        `koanf:"dead_letter_file"`
+}
+
+func (c OutboxConfig) withDefaults() OutboxConfig {
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultQueueSize
+	}
+	if c.Workers <= 0 {
+		c.Workers = DefaultWorkers
+	}
+	if c.RetryCnt < 0 {
+		c.RetryCnt = 0
+	} else if c.RetryCnt == 0 {
+		c.RetryCnt = DefaultRetryCnt
+	}
+	if c.RetryBackOff <= 0 {
+		c.RetryBackOff = DefaultRetryBackOff
+	}
+	if c.RetryBackOffMax <= 0 {
+		c.RetryBackOffMax = DefaultRetryBackOffMax
+	}
+	return c
+}
+
+// permanentError marks a failure which will not go away on retry.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err so the outbox gives up on the message right away.
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// retryAfterError tells the outbox how long to wait before the next retry,
+// e.g. from a rate limit response.
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+// RetryAfter wraps err so the outbox waits at least d before retrying.
+func RetryAfter(err error, d time.Duration) error {
+	return &retryAfterError{err, d}
+}
+
+func retryAfterOf(err error) time.Duration {
+	var r *retryAfterError
+	if errors.As(err, &r) {
+		return r.after
+	}
+	return 0
+}
+
+// partialError is a failure to deliver a message to some of its destinations.
+type partialError struct {
+	err error
+	// the part of the message which was not delivered
+	msg Msg
+}
+
+func (e *partialError) Error() string {
+	return e.err.Error()
+}
+
+func (e *partialError) Unwrap() error {
+	return e.err
+}
+
+// Partial wraps err so the outbox retries msg, the part of the message not
+// delivered yet, rather than the whole message.
+func Partial(err error, msg Msg) error {
+	return &partialError{err, msg}
+}
+
+func undeliveredOf(err error) (Msg, bool) {
+	var p *partialError
+	if errors.As(err, &p) {
+		return p.msg, true
+	}
+	return nil, false
+}
+
+// fanOut collects the failures of delivering a message to several
+// destinations, e.g. chats or endpoints. Only the destinations which failed
+// for now are retried, the ones failed for good are given up.
+type fanOut struct {
+	// names the destinations in errors, e.g. chat
+	kind       string
+	total      int
+	failed     []string
+	errs       []error
+	permanent  []error
+	retryAfter time.Duration
+}
+
+func (f *fanOut) add(destination string, err error) {
+	f.total++
+	if err == nil {
+		return
+	}
+	err = fmt.Errorf("%s %s: %w", f.kind, destination, err)
+	if IsPermanent(err) {
+		f.permanent = append(f.permanent, err)
+		return
+	}
+	f.failed = append(f.failed, destination)
+	f.errs = append(f.errs, err)
+	if after := retryAfterOf(err); after > f.retryAfter {
+		f.retryAfter = after
+	}
+}
+
+// err returns the failures to retry, Partial with the message routed by
+// route to the failed destinations unless all of them failed. The failures
+// for good are returned as a Permanent error if there is nothing to retry,
+// logged otherwise.
+func (f *fanOut) err(route func(failed []string) Msg) error {
+	if len(f.errs) == 0 {
+		if len(f.permanent) == 0 {
+			return nil
+		}
+		return Permanent(errors.Join(f.permanent...))
+	}
+	for _, err := range f.permanent {
+		log.Errorf("deliver failed, given up: %s", err)
+	}
+	err := errors.Join(f.errs...)
+	if f.retryAfter > 0 {
+		err = RetryAfter(err, f.retryAfter)
+	}
+	if len(f.failed) < f.total {
+		return Partial(err, route(f.failed))
+	}
+	return err
+}
+
+type OutboxMetrics struct {
+	Enqueued  uint64
+	Delivered uint64
+	Retried   uint64
+	Failed    uint64
+	Dropped   uint64
+}
+
+type outboxMetrics struct {
+	enqueued, delivered, retried, failed, dropped atomic.Uint64
+}
+
+// DeadLetter appends messages which could not be delivered to a file as JSON
+// lines, an empty path only logs them.
+type DeadLetter struct {
+	mu   sync.Mutex
+	path string
+}
+
+type deadLetterEntry struct {
+	Time    time.Time `json:"time"`
+	Notice  string    `json:"notice"`
+	Service string    `json:"service,omitempty"`
+	Msg     string    `json:"msg"`
+	Error   string    `json:"error"`
+}
+
+func NewDeadLetter(path string) *DeadLetter {
+	return &DeadLetter{path: path}
+}
+
+func (d *DeadLetter) Write(notice string, msg Msg, srv any, cause error) {
+	entry := deadLetterEntry{
+		Time:    time.Now(),
+		Notice:  notice,
+		Service: serviceName(srv),
+		Msg:     msg.String(),
+		Error:   cause.Error(),
+	}
+	log.WithField("notice", notice).
+		WithField("service", entry.Service).
+		Errorf("notice dead: %s", cause)
+	if d.path == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("encode dead letter failed: %s", err)
+		return
+	}
+	f, err := os.OpenFile(d.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Errorf("open dead letter file failed: %s", err)
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Errorf("write dead letter failed: %s", err)
+	}
+}
+
+type outboxJob struct {
+	msg Msg
+	srv any
+}
+
+// Outbox delivers messages of a notice asynchronously through a bounded queue
+// and a worker pool, retrying failed deliveries with backoff. Messages which
+// exhaust their retries or find the queue full go to the dead letter.
+type Outbox struct {
+	notice     Notice
+	name       string
+	cfg        OutboxConfig
+	deadLetter *DeadLetter
+	queue      chan outboxJob
+	closed     chan struct{}
+	// guards sending to queue against closing it
+	mu        sync.RWMutex
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	metrics   outboxMetrics
+}
+
+func NewOutbox(n Notice, cfg OutboxConfig, deadLetter *DeadLetter) *Outbox {
+	cfg = cfg.withDefaults()
+	o := &Outbox{
+		notice:     n,
+		name:       noticeName(n),
+		cfg:        cfg,
+		deadLetter: deadLetter,
+		queue:      make(chan outboxJob, cfg.QueueSize),
+		closed:     make(chan struct{}),
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		o.wg.Add(1)
+		go o.work()
+	}
+	return o
+}
+
+func (o *Outbox) Name() string {
+	return o.name
+}
+
+// Notice enqueues the message without waiting for its delivery.
+func (o *Outbox) Notice(msg Msg, srv any) error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	select {
+	case <-o.closed:
+		o.metrics.dropped.Add(1)
+		o.deadLetter.Write(o.name, msg, srv, ErrOutboxClosed)
+		return ErrOutboxClosed
+	default:
+	}
+
+	select {
+	case o.queue <- outboxJob{msg, srv}:
+		o.metrics.enqueued.Add(1)
+		return nil
+	default:
+		o.metrics.dropped.Add(1)
+		o.deadLetter.Write(o.name, msg, srv, ErrQueueFull)
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting messages and waits until the queued ones are tried
+// once more, pending retries are given up.
+func (o *Outbox) Close() {
+	o.closeOnce.Do(func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		close(o.closed)
+		close(o.queue)
+	})
+	o.wg.Wait()
+}
+
+func (o *Outbox) Metrics() OutboxMetrics {
+	return OutboxMetrics{
+		Enqueued:  o.metrics.enqueued.Load(),
+		Delivered: o.metrics.delivered.Load(),
+		Retried:   o.metrics.retried.Load(),
+		Failed:    o.metrics.failed.Load(),
+		Dropped:   o.metrics.dropped.Load(),
+	}
+}
+
+func (o *Outbox) work() {
+	defer o.wg.Done()
+	for job := range o.queue {
+		o.deliver(job)
+	}
+}
+
+func (o *Outbox) deliver(job outboxJob) {
+	backOff := o.cfg.RetryBackOff
+	for retry := 0; ; retry++ {
+		err := o.notice.Notice(job.msg, job.srv)
+		if err == nil {
+			o.metrics.delivered.Add(1)
+			return
+		}
+		if msg, ok := undeliveredOf(err); ok {
+			job.msg = msg
+		}
+		if retry >= o.cfg.RetryCnt || IsPermanent(err) {
+			o.metrics.failed.Add(1)
+			o.deadLetter.Write(o.name, job.msg, job.srv, fmt.Errorf("after %d retries: %w", retry, err))
+			return
+		}
+
+		o.metrics.retried.Add(1)
+		wait := backOff
+		if after := retryAfterOf(err); after > wait {
+			wait = after
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-o.closed:
+			timer.Stop()
+			o.metrics.failed.Add(1)
+			o.deadLetter.Write(o.name, job.msg, job.srv, fmt.Errorf("%w: %w", ErrOutboxClosed, err))
+			return
+		case <-timer.C:
+		}
+		backOff *= 2
+		if backOff > o.cfg.RetryBackOffMax {
+			backOff = o.cfg.RetryBackOffMax
+		}
+	}
+}
+
+func noticeName(n Notice) string {
+	if named, ok := n.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", n)
+}
+
+func serviceName(srv any) string {
+	if named, ok := srv.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return ""
+}
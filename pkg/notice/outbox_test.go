@@ -0,0 +1,141 @@
+package notice
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestOutbox(t *testing.T) {
+	suite.Run(t, new(OutboxTestSuite))
+}
+
+// FlakyNotice fails the first failures deliveries
+type FlakyNotice struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	calls    int
+	msgs     []string
+}
+
+func (n *FlakyNotice) Notice(msg Msg, srv any) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if n.calls <= n.failures {
+		return n.err
+	}
+	n.msgs = append(n.msgs, msg.String())
+	return nil
+}
+
+type OutboxTestSuite struct {
+	suite.Suite
+
+	notice     *FlakyNotice
+	deadLetter string
+	cfg        OutboxConfig
+}
+
+func (s *OutboxTestSuite) SetupTest() {
+	s.notice = &FlakyNotice{err: errors.New("connection reset")}
+	s.deadLetter = filepath.Join(s.T().TempDir(), "dead.jsonl")
+	s.cfg = OutboxConfig{
+		RetryCnt:     2,
+		RetryBackOff: time.Millisecond,
+	}
+}
+
+func (s *OutboxTestSuite) newOutbox() *Outbox {
+	return NewOutbox(s.notice, s.cfg, NewDeadLetter(s.deadLetter))
+}
+
+func (s *OutboxTestSuite) waitHandled(o *Outbox) {
+	s.Eventually(func() bool {
+		m := o.Metrics()
+		return m.Delivered+m.Failed == m.Enqueued
+	}, time.Second, time.Millisecond)
+}
+
+func (s *OutboxTestSuite) TestRetryUntilDelivered() {
+	s.notice.failures = 2
+	o := s.newOutbox()
+	s.NoError(o.Notice(TextMsg("msg"), nil))
+	s.waitHandled(o)
+	o.Close()
+
+	s.Equal([]string{"msg"}, s.notice.msgs)
+	s.Equal(OutboxMetrics{Enqueued: 1, Delivered: 1, Retried: 2}, o.Metrics())
+	s.NoFileExists(s.deadLetter)
+}
+
+func (s *OutboxTestSuite) TestDeadLetter() {
+	s.notice.failures = 10
+	o := s.newOutbox()
+	s.NoError(o.Notice(TextMsg("lost msg"), nil))
+	s.waitHandled(o)
+	o.Close()
+
+	s.Equal(uint64(1), o.Metrics().Failed)
+	data, err := os.ReadFile(s.deadLetter)
+	s.NoError(err)
+	s.Equal(1, strings.Count(string(data), "\n"))
+	s.Contains(string(data), "lost msg")
+	s.Contains(string(data), "connection reset")
+}
+
+func (s *OutboxTestSuite) TestPermanentError() {
+	s.notice.failures = 10
+	s.notice.err = Permanent(errors.New("bad token"))
+	o := s.newOutbox()
+	s.NoError(o.Notice(TextMsg("msg"), nil))
+	o.Close()
+
+	s.Equal(1, s.notice.calls)
+	s.Equal(uint64(1), o.Metrics().Failed)
+}
+
+func (s *OutboxTestSuite) TestPartialError() {
+	s.notice.failures = 1
+	s.notice.err = Partial(errors.New("chat -200: connection reset"), TextMsg("undelivered"))
+	o := s.newOutbox()
+	s.NoError(o.Notice(TextMsg("msg"), nil))
+	s.waitHandled(o)
+	o.Close()
+
+	s.Equal([]string{"undelivered"}, s.notice.msgs)
+	s.Equal(uint64(1), o.Metrics().Delivered)
+}
+
+func (s *OutboxTestSuite) TestQueueFull() {
+	s.cfg.QueueSize = 1
+	s.cfg.Workers = 1
+	s.notice.failures = 10
+	s.cfg.RetryBackOff = time.Hour
+	o := s.newOutbox()
+	defer o.Close()
+
+	// the worker blocks on the first message, the second fills the queue
+	s.NoError(o.Notice(TextMsg("1"), nil))
+	s.Eventually(func() bool {
+		s.notice.mu.Lock()
+		defer s.notice.mu.Unlock()
+		return s.notice.calls > 0
+	}, time.Second, time.Millisecond)
+	s.NoError(o.Notice(TextMsg("2"), nil))
+	s.ErrorIs(o.Notice(TextMsg("3"), nil), ErrQueueFull)
+	s.Equal(uint64(1), o.Metrics().Dropped)
+}
+
+func (s *OutboxTestSuite) TestNoticeAfterClose() {
+	o := s.newOutbox()
+	o.Close()
+	s.ErrorIs(o.Notice(TextMsg("msg"), nil), ErrOutboxClosed)
+}
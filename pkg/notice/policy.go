@@ -0,0 +1,388 @@
+package notice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const DefaultAckPath = "/ack"
+
+// PolicyConfig holds back alerts during quiet hours and escalates severe
+// alerts nobody acknowledges.
+type PolicyConfig struct {
+	// IANA name of the timezone of the quiet hours, the local one (TZ) if
+	// empty
+	Timezone string `koanf:"timezone"`
+	// notice or channel name -> quiet hours
+	QuietHours map[string]QuietHours `koanf:"quiet_hours"`
+	Escalation EscalationConfig      `koanf:"escalation"`
+	Ack        AckConfig             `koanf:"ack"`
+}
+
+// QuietHours holds back alerts up to Severity from Start to End, e.g. 23:00
+// to 08:00. The alerts held back are sent as a digest listing every one of
+// them when the quiet hours end.
+type QuietHours struct {
+	Start    string   `koanf:"start"`
+	End      string   `koanf:"end"`
+	Severity Severity `koanf:"severity"`
+}
+
+// EscalationConfig re-sends alerts of at least Severity which are not
+// acknowledged within After, mentioning everyone or to Channels instead of
+// their usual destinations.
+type EscalationConfig struct {
+	// escalation is disabled if zero
+	After time.Duration `koanf:"after"`
+	// critical if not set
+	Severity   *Severity `koanf:"severity"`
+	MentionAll bool      `koanf:"mention_all"`
+	Channels   []string  `koanf:"channels"`
+}
+
+// AckConfig serves acknowledgements on Listen, as GET or POST Path?id=<id>,
+// or as a DingTalk outgoing robot posting "ack <id>". Requests must carry
+// token=<Token> in the query, Token is required to listen.
+type AckConfig struct {
+	// the endpoint is disabled if empty, e.g. :8080
+	Listen string `koanf:"listen"`
+	Path   string `koanf:"path"`
+	Token  string `koanf:"token"`
+	// public url of the endpoint linked in alerts, e.g.
+	// https://plutus.example.com/ack?token=<TOKEN>
+	URL string `koanf:"url"`
+}
+
+// quietWindow is a parsed QuietHours, in minutes of the day.
+type quietWindow struct {
+	start    int
+	end      int
+	severity Severity
+}
+
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// until returns when the quiet hours containing now end, zero if now is not
+// in quiet hours.
+func (w quietWindow) until(now time.Time) time.Time {
+	minute := now.Hour()*60 + now.Minute()
+	var quiet bool
+	if w.start < w.end {
+		quiet = minute >= w.start && minute < w.end
+	} else {
+		quiet = minute >= w.start || minute < w.end
+	}
+	if !quiet {
+		return time.Time{}
+	}
+	end := time.Date(now.Year(), now.Month(), now.Day(), w.end/60, w.end%60, 0, 0, now.Location())
+	if !end.After(now) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+// EscalatedMsg re-sends an alert nobody acknowledged.
+type EscalatedMsg struct {
+	*Alert
+}
+
+func (m *EscalatedMsg) summarized() *Alert {
+	return m.Alert
+}
+
+// heldAlerts are the alerts held back from a notice or channel in quiet hours.
+type heldAlerts struct {
+	alerts []*Alert
+	timer  *time.Timer
+	// where the digest goes, and the message routed there
+	notice Notice
+	routed Msg
+}
+
+// Policy applies quiet hours and escalations.
+type Policy struct {
+	cfg      PolicyConfig
+	location *time.Location
+	quiet    map[string]quietWindow
+	// least severity escalated
+	escalated Severity
+
+	mu sync.Mutex
+	// notice or channel name -> alerts held back in quiet hours
+	held map[string]*heldAlerts
+	// alert id -> escalation timer
+	pending map[string]*time.Timer
+	server  *http.Server
+}
+
+func NewPolicy(cfg PolicyConfig) *Policy {
+	if cfg.Ack.Path == "" {
+		cfg.Ack.Path = DefaultAckPath
+	}
+	p := &Policy{
+		cfg:       cfg,
+		location:  time.Local,
+		quiet:     map[string]quietWindow{},
+		escalated: SeverityCritical,
+		held:      map[string]*heldAlerts{},
+		pending:   map[string]*time.Timer{},
+	}
+	if cfg.Escalation.Severity != nil {
+		p.escalated = *cfg.Escalation.Severity
+	}
+	if cfg.Timezone != "" {
+		location, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			log.Errorf("load timezone %s failed, using local time: %v", cfg.Timezone, err)
+		} else {
+			p.location = location
+		}
+	}
+	for name, hours := range cfg.QuietHours {
+		start, err := parseClock(hours.Start)
+		if err == nil {
+			var end int
+			end, err = parseClock(hours.End)
+			p.quiet[name] = quietWindow{start, end, hours.Severity}
+		}
+		if err != nil {
+			delete(p.quiet, name)
+			log.Errorf("quiet hours of %s ignored: %v", name, err)
+		}
+	}
+	return p
+}
+
+// Allow reports whether the notice, or the channel the message is routed to,
+// is not in quiet hours for the message. Messages held back are sent as a
+// digest to the same destination when the quiet hours end.
+func (p *Policy) Allow(n Notice, msg Msg, srv any) bool {
+	name := destination(n, msg)
+	w, ok := p.quiet[name]
+	if !ok || w.start == w.end {
+		return true
+	}
+	alert := AlertOf(msg, srv)
+	if alert.Severity > w.severity {
+		return true
+	}
+	now := time.Now().In(p.location)
+	end := w.until(now)
+	if end.IsZero() {
+		return true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if h, ok := p.held[name]; ok {
+		h.alerts = append(h.alerts, alert)
+		return false
+	}
+	h := &heldAlerts{alerts: []*Alert{alert}, notice: n, routed: msg}
+	p.held[name] = h
+	h.timer = time.AfterFunc(end.Sub(now), func() {
+		p.mu.Lock()
+		delete(p.held, name)
+		p.mu.Unlock()
+		_ = n.Notice(p.quietDigest(h), nil)
+	})
+	return false
+}
+
+// quietDigest lists the alerts held back, linked to their transactions.
+func (p *Policy) quietDigest(h *heldAlerts) Msg {
+	summary := &Alert{
+		Title: Labelf("quiet_digest", len(h.alerts)),
+		Time:  time.Now(),
+	}
+	for _, alert := range h.alerts {
+		if alert.Severity > summary.Severity {
+			summary.Severity = alert.Severity
+		}
+		summary.Links = append(summary.Links, Link{Text: alert.title(), URL: alert.TxURL()})
+	}
+	return reroute(&DigestMsg{Alert: summary, Alerts: h.alerts}, h.routed)
+}
+
+func newAlertID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Track gives a severe alert an id, linked to its acknowledgement if the
+// endpoint has a public url, and escalates it through escalate unless it is
+// acknowledged in time. Other messages are returned as they are.
+func (p *Policy) Track(msg Msg, srv any, escalate func(msg Msg, srv any)) Msg {
+	if p.cfg.Escalation.After <= 0 {
+		return msg
+	}
+	if _, ok := msg.(summaryMsg); ok {
+		return msg
+	}
+	alert := AlertOf(msg, srv)
+	if alert.Retracted || alert.Severity < p.escalated {
+		return msg
+	}
+
+	alert.ID = newAlertID()
+	if link := p.ackURL(alert.ID); link != "" {
+		alert.Links = append(append([]Link(nil), alert.Links...), Link{Text: Label("ack"), URL: link})
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending[alert.ID] = time.AfterFunc(p.cfg.Escalation.After, func() {
+		p.mu.Lock()
+		_, ok := p.pending[alert.ID]
+		delete(p.pending, alert.ID)
+		p.mu.Unlock()
+		if ok {
+			escalate(p.escalation(alert), srv)
+		}
+	})
+	return alert
+}
+
+func (p *Policy) escalation(alert *Alert) *EscalatedMsg {
+	escalated := *alert
+	escalated.Title = Labelf("escalated", alert.ID, p.cfg.Escalation.After, alert.Title)
+	escalated.MentionAll = p.cfg.Escalation.MentionAll
+	escalated.Time = time.Now()
+	return &EscalatedMsg{&escalated}
+}
+
+func (p *Policy) ackURL(id string) string {
+	if p.cfg.Ack.URL == "" {
+		return ""
+	}
+	u, err := url.Parse(p.cfg.Ack.URL)
+	if err != nil {
+		return ""
+	}
+	query := u.Query()
+	query.Set("id", id)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Ack acknowledges the alert, reports whether it was pending.
+func (p *Policy) Ack(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	timer, ok := p.pending[id]
+	if ok {
+		timer.Stop()
+		delete(p.pending, id)
+	}
+	return ok
+}
+
+// dingtalkOutgoing is the message a DingTalk outgoing robot posts.
+type dingtalkOutgoing struct {
+	Text struct {
+		Content string `json:"content"`
+	} `json:"text"`
+}
+
+// ServeHTTP acknowledges the alert of the id in the query, or of the "ack
+// <id>" command posted by a DingTalk outgoing robot.
+func (p *Policy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if p.cfg.Ack.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(p.cfg.Ack.Token)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	dingtalk := false
+	if id == "" && r.Method == http.MethodPost {
+		var outgoing dingtalkOutgoing
+		if err := json.NewDecoder(r.Body).Decode(&outgoing); err == nil {
+			fields := strings.Fields(outgoing.Text.Content)
+			if len(fields) == 2 && strings.EqualFold(fields[0], "ack") {
+				id, dingtalk = fields[1], true
+			}
+		}
+	}
+	if id == "" {
+		http.Error(w, "missing alert id", http.StatusBadRequest)
+		return
+	}
+
+	reply := Labelf("acknowledged", id)
+	if !p.Ack(id) {
+		reply = Labelf("ack_unknown_alert", id)
+	}
+	log.WithField("id", id).Info(reply)
+	if dingtalk {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"msgtype": "text",
+			"text":    map[string]string{"content": reply},
+		})
+		return
+	}
+	_, _ = w.Write([]byte(reply))
+}
+
+// Serve starts the acknowledgement endpoint if configured.
+func (p *Policy) Serve() {
+	if p.cfg.Ack.Listen == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(p.cfg.Ack.Path, p)
+	p.mu.Lock()
+	p.server = &http.Server{Addr: p.cfg.Ack.Listen, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	server := p.server
+	p.mu.Unlock()
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Errorf("ack endpoint failed: %v", err)
+		}
+	}()
+}
+
+// Close sends the digests of alerts held back right away, stops pending
+// escalations and the acknowledgement endpoint.
+func (p *Policy) Close() {
+	p.mu.Lock()
+	var held []*heldAlerts
+	for name, h := range p.held {
+		if h.timer.Stop() {
+			held = append(held, h)
+		}
+		delete(p.held, name)
+	}
+	for id, timer := range p.pending {
+		timer.Stop()
+		delete(p.pending, id)
+	}
+	server := p.server
+	p.mu.Unlock()
+
+	for _, h := range held {
+		_ = h.notice.Notice(p.quietDigest(h), nil)
+	}
+	if server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}
+}
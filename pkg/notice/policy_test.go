@@ -0,0 +1,181 @@
+package notice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestPolicy(t *testing.T) {
+	suite.Run(t, new(PolicyTestSuite))
+}
+
+type PolicyTestSuite struct {
+	suite.Suite
+
+	notice *RecordingNotice
+}
+
+func (s *PolicyTestSuite) SetupTest() {
+	s.notice = &RecordingNotice{}
+}
+
+func (s *PolicyTestSuite) TestQuietWindow() {
+	loc := time.FixedZone("CST", 8*3600)
+	at := func(hour int, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, loc)
+	}
+
+	night := quietWindow{start: 23 * 60, end: 8 * 60}
+	s.Equal(at(8, 0).AddDate(0, 0, 1), night.until(at(23, 30)))
+	s.Equal(at(8, 0), night.until(at(2, 0)))
+	s.True(night.until(at(8, 0)).IsZero())
+	s.True(night.until(at(12, 0)).IsZero())
+
+	lunch := quietWindow{start: 12 * 60, end: 13*60 + 30}
+	s.Equal(at(13, 30), lunch.until(at(12, 0)))
+	s.True(lunch.until(at(13, 30)).IsZero())
+}
+
+// allDay returns quiet hours containing now.
+func (s *PolicyTestSuite) allDay(severity Severity) QuietHours {
+	now := time.Now()
+	return QuietHours{
+		Start:    now.Add(-time.Hour).Format("15:04"),
+		End:      now.Add(time.Hour).Format("15:04"),
+		Severity: severity,
+	}
+}
+
+func (s *PolicyTestSuite) TestQuietHours() {
+	p := NewPolicy(PolicyConfig{
+		QuietHours: map[string]QuietHours{
+			"recording": s.allDay(SeverityWarning),
+			"broken":    {Start: "25:00", End: "08:00"},
+		},
+	})
+	s.NotContains(p.quiet, "broken")
+
+	info := testAlert()
+	info.Severity = SeverityInfo
+	s.False(p.Allow(s.notice, info, nil))
+	s.False(p.Allow(s.notice, TextMsg("msg"), nil))
+	s.True(p.Allow(s.notice, testAlert(), nil))
+	s.True(p.Allow(&DummyNotice{}, info, nil))
+	routed := &RoutedMsg{Msg: info, ChannelName: "group-a"}
+	s.True(p.Allow(s.notice, routed, nil))
+
+	p.Close()
+	msgs := s.notice.Msgs()
+	s.Require().Len(msgs, 1)
+	s.Equal("静默时段内有 2 条告警被暂缓", AlertOf(msgs[0], nil).Title)
+	// the alerts held back are delivered with the digest
+	digest := msgs[0].(*DigestMsg)
+	s.Len(digest.Alerts, 2)
+	s.Equal([]Link{{Text: info.Title, URL: "https://bscscan.com/tx/0x01"}, {Text: "msg"}}, digest.Links)
+	s.Equal(SeverityInfo, digest.Severity)
+}
+
+func (s *PolicyTestSuite) TestQuietHoursChannel() {
+	p := NewPolicy(PolicyConfig{
+		QuietHours: map[string]QuietHours{"group-a": s.allDay(SeverityCritical)},
+	})
+	routed := &RoutedMsg{Msg: testAlert(), ChannelName: "group-a", Channel: Channel{Token: "a"}}
+	s.False(p.Allow(s.notice, routed, nil))
+	s.True(p.Allow(s.notice, testAlert(), nil))
+
+	p.Close()
+	msgs := s.notice.Msgs()
+	s.Require().Len(msgs, 1)
+	summary := msgs[0].(*RoutedMsg)
+	s.Equal("a", summary.Channel.Token)
+	s.Equal(SeverityCritical, SeverityOf(summary))
+}
+
+func (s *PolicyTestSuite) TestEscalation() {
+	p := NewPolicy(PolicyConfig{
+		Escalation: EscalationConfig{After: 50 * time.Millisecond, MentionAll: true},
+		Ack:        AckConfig{URL: "https://plutus.example.com/ack?token=secret"},
+	})
+	defer p.Close()
+	escalate := func(msg Msg, srv any) {
+		_ = s.notice.Notice(msg, srv)
+	}
+
+	info := testAlert()
+	info.Severity = SeverityWarning
+	s.Same(info, p.Track(info, nil, escalate))
+	s.Equal(TextMsg("msg"), p.Track(TextMsg("msg"), nil, escalate))
+
+	acked := p.Track(testAlert(), nil, escalate).(*Alert)
+	s.True(p.Ack(acked.ID))
+	s.False(p.Ack(acked.ID))
+
+	tracked := p.Track(testAlert(), nil, escalate).(*Alert)
+	s.Len(tracked.ID, 32)
+	s.Equal(Link{Text: "确认告警", URL: "https://plutus.example.com/ack?id=" + tracked.ID + "&token=secret"},
+		tracked.Links[len(tracked.Links)-1])
+	s.Equal("alert_id", tracked.Card().Fields[0].Name)
+
+	s.Eventually(func() bool { return len(s.notice.Msgs()) == 1 }, time.Second, 10*time.Millisecond)
+	escalated := s.notice.Msgs()[0].(*EscalatedMsg)
+	s.Equal(tracked.ID, escalated.ID)
+	s.True(escalated.MentionAll)
+	s.True(strings.HasPrefix(escalated.Title, "告警 "+tracked.ID+" 超过 50ms 未确认: "))
+	s.False(p.Ack(tracked.ID))
+	s.Equal(escalated, p.Track(escalated, nil, escalate))
+}
+
+func (s *PolicyTestSuite) TestEscalationSeverity() {
+	info := SeverityInfo
+	p := NewPolicy(PolicyConfig{Escalation: EscalationConfig{After: time.Minute, Severity: &info}})
+	defer p.Close()
+
+	alert := testAlert()
+	alert.Severity = SeverityInfo
+	s.NotEmpty(p.Track(alert, nil, nil).(*Alert).ID)
+}
+
+func (s *PolicyTestSuite) TestServeHTTP() {
+	p := NewPolicy(PolicyConfig{
+		Escalation: EscalationConfig{After: time.Minute},
+		Ack:        AckConfig{Token: "secret"},
+	})
+	defer p.Close()
+	ack := func(method string, query url.Values, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(method, "/ack?"+query.Encode(), strings.NewReader(body)))
+		return w
+	}
+
+	first := p.Track(testAlert(), nil, nil).(*Alert)
+	second := p.Track(testAlert(), nil, nil).(*Alert)
+
+	s.Equal(http.StatusForbidden, ack(http.MethodGet, url.Values{"id": {first.ID}}, "").Code)
+	s.Equal(http.StatusForbidden, ack(http.MethodGet, url.Values{"token": {"secreT"}, "id": {first.ID}}, "").Code)
+	s.Equal(http.StatusBadRequest, ack(http.MethodGet, url.Values{"token": {"secret"}}, "").Code)
+
+	w := ack(http.MethodGet, url.Values{"token": {"secret"}, "id": {first.ID}}, "")
+	s.Equal(http.StatusOK, w.Code)
+	s.Equal("告警 "+first.ID+" 已确认", w.Body.String())
+	w = ack(http.MethodGet, url.Values{"token": {"secret"}, "id": {first.ID}}, "")
+	s.Equal("告警 "+first.ID+" 不存在或已确认", w.Body.String())
+
+	w = ack(http.MethodPost, url.Values{"token": {"secret"}}, `{"msgtype":"text","text":{"content":" ack `+second.ID+`"}}`)
+	s.Equal(http.StatusOK, w.Code)
+	s.JSONEq(`{"msgtype":"text","text":{"content":"告警 `+second.ID+` 已确认"}}`, w.Body.String())
+	s.False(p.Ack(second.ID))
+
+	// nothing is acknowledged without a token configured
+	open := NewPolicy(PolicyConfig{Escalation: EscalationConfig{After: time.Minute}})
+	defer open.Close()
+	third := open.Track(testAlert(), nil, nil).(*Alert)
+	w = httptest.NewRecorder()
+	open.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ack?id="+third.ID, nil))
+	s.Equal(http.StatusForbidden, w.Code)
+}
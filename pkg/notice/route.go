@@ -0,0 +1,124 @@
+package notice
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// Channel is a named destination of a notice, e.g. a DingTalk robot or a set
+// of Telegram chats. Fields not used by the notice are ignored.
+type Channel struct {
+	Notice string `koanf:"notice"`
+	// dingtalk robot
+	Token  string `koanf:"token"`
+	Secret string `koanf:"secret"`
+	// telegram chat ids
+	Chats []string `koanf:"chats"`
+	// slack or discord webhook url
+	Webhook string `koanf:"webhook"`
+	// names of the webhook endpoints
+	Endpoints []string `koanf:"endpoints"`
+}
+
+// Route sends alerts matching all of its filters to its channels, an empty
+// filter matches anything.
+type Route struct {
+	Services   []string   `koanf:"services"`
+	Severities []Severity `koanf:"severities"`
+	Groups     []string   `koanf:"groups"`
+	Channels   []string   `koanf:"channels"`
+}
+
+func contains[T comparable](list []T, v T) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Route) match(alert *Alert) bool {
+	return (len(r.Services) == 0 || contains(r.Services, alert.Service)) &&
+		(len(r.Severities) == 0 || contains(r.Severities, alert.Severity)) &&
+		(len(r.Groups) == 0 || contains(r.Groups, alert.Group))
+}
+
+// RoutedMsg is a message delivered to a channel.
+type RoutedMsg struct {
+	Msg
+	ChannelName string
+	Channel     Channel
+}
+
+// ChannelOf returns the channel msg is routed to, if it is.
+func ChannelOf(msg Msg) (Channel, bool) {
+	if routed, ok := msg.(*RoutedMsg); ok {
+		return routed.Channel, true
+	}
+	return Channel{}, false
+}
+
+// destination names where msg goes through n, the channel it is routed to or
+// the notice itself.
+func destination(n Notice, msg Msg) string {
+	if routed, ok := msg.(*RoutedMsg); ok {
+		return routed.ChannelName
+	}
+	return noticeName(n)
+}
+
+// reroute sends msg to the same channel as routed, if it is.
+func reroute(msg Msg, routed Msg) Msg {
+	if r, ok := routed.(*RoutedMsg); ok {
+		return &RoutedMsg{Msg: msg, ChannelName: r.ChannelName, Channel: r.Channel}
+	}
+	return msg
+}
+
+// Router maps alerts to channels. Without routes every notice receives every
+// alert, with its destinations looked up by service.
+type Router struct {
+	routes   []Route
+	channels map[string]Channel
+}
+
+func NewRouter(routes []Route, channels map[string]Channel) *Router {
+	r := &Router{channels: channels}
+	for _, route := range routes {
+		valid := route.Channels[:0:0]
+		for _, name := range route.Channels {
+			if _, ok := channels[name]; !ok {
+				log.Errorf("route to unknown channel %s ignored", name)
+				continue
+			}
+			valid = append(valid, name)
+		}
+		route.Channels = valid
+		r.routes = append(r.routes, route)
+	}
+	return r
+}
+
+func (r *Router) Enabled() bool {
+	return len(r.routes) > 0
+}
+
+// Route returns the names of the channels matching the alert, each once.
+func (r *Router) Route(alert *Alert) []string {
+	var ret []string
+	for _, route := range r.routes {
+		if !route.match(alert) {
+			continue
+		}
+		for _, name := range route.Channels {
+			if !contains(ret, name) {
+				ret = append(ret, name)
+			}
+		}
+	}
+	return ret
+}
+
+func (r *Router) Channel(name string) Channel {
+	return r.channels[name]
+}
@@ -0,0 +1,69 @@
+package notice
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestRoute(t *testing.T) {
+	suite.Run(t, new(RouteTestSuite))
+}
+
+type RouteTestSuite struct {
+	suite.Suite
+	channels map[string]Channel
+}
+
+func (s *RouteTestSuite) SetupTest() {
+	s.channels = map[string]Channel{
+		"group-a":  {Notice: "recording", Token: "a"},
+		"transfer": {Notice: "recording", Token: "b"},
+		"oncall":   {Notice: "recording", Token: "c"},
+	}
+}
+
+func (s *RouteTestSuite) TearDownTest() {
+	notices = nil
+	router = nil
+}
+
+func (s *RouteTestSuite) TestRoute() {
+	r := NewRouter([]Route{
+		{Services: []string{"constructor"}, Groups: []string{"A"}, Channels: []string{"group-a"}},
+		{Services: []string{"transfer"}, Channels: []string{"transfer", "unknown"}},
+		{Severities: []Severity{SeverityCritical}, Channels: []string{"oncall", "transfer"}},
+	}, s.channels)
+	s.True(r.Enabled())
+
+	s.Equal([]string{"group-a"}, r.Route(&Alert{Service: "constructor", Group: "A"}))
+	s.Empty(r.Route(&Alert{Service: "constructor", Group: "B"}))
+	s.Equal([]string{"transfer"}, r.Route(&Alert{Service: "transfer"}))
+	s.Equal([]string{"transfer", "oncall"}, r.Route(&Alert{Service: "transfer", Severity: SeverityCritical}))
+	s.Equal([]string{"group-a", "oncall", "transfer"}, r.Route(&Alert{Service: "constructor", Group: "A", Severity: SeverityCritical}))
+	s.Equal("b", r.Channel("transfer").Token)
+
+	s.False(NewRouter(nil, s.channels).Enabled())
+}
+
+func (s *RouteTestSuite) TestBroadcast() {
+	n := &RecordingNotice{}
+	notices = []Notice{n, &DummyNotice{}}
+	router = NewRouter([]Route{
+		{Groups: []string{"A"}, Channels: []string{"group-a"}},
+	}, s.channels)
+
+	alert := testAlert()
+	alert.Group = "A"
+	broadcast(alert, nil)
+	broadcast(testAlert(), nil)
+
+	msgs := n.Msgs()
+	s.Require().Len(msgs, 1)
+	routed := msgs[0].(*RoutedMsg)
+	s.Equal("group-a", routed.ChannelName)
+	s.Equal("a", routed.Channel.Token)
+	s.Equal("A", AlertOf(routed, nil).Group)
+	s.Equal(SeverityCritical, SeverityOf(routed))
+	s.Empty(notices[1].(*DummyNotice).msg)
+}
@@ -0,0 +1,59 @@
+package notice
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+var severityNames = map[Severity]string{
+	SeverityInfo:     "info",
+	SeverityWarning:  "warning",
+	SeverityCritical: "critical",
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	for severity, name := range severityNames {
+		if strings.EqualFold(name, string(text)) {
+			*s = severity
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// SeverityOf returns the severity of msg, messages without one are info.
+func SeverityOf(msg Msg) Severity {
+	switch m := msg.(type) {
+	case *Alert:
+		return m.Severity
+	case summaryMsg:
+		return m.summarized().Severity
+	case *RetractedMsg:
+		return SeverityInfo
+	case *RoutedMsg:
+		return SeverityOf(m.Msg)
+	}
+	if m, ok := msg.(interface{ Severity() Severity }); ok {
+		return m.Severity()
+	}
+	return SeverityInfo
+}
@@ -0,0 +1,120 @@
+package notice
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SlackConfig struct {
+	Webhooks Webhooks `koanf:"webhooks"`
+}
+
+// Slack posts Block Kit messages to incoming webhooks.
+type Slack struct {
+	cfg SlackConfig
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+var slackDialect = dialect{
+	escape: slackEscaper.Replace,
+	link: func(text string, url string) string {
+		return fmt.Sprintf("<%s|%s>", url, slackEscaper.Replace(text))
+	},
+	heading: func(text string) string {
+		return "*" + slackEscaper.Replace(text) + "*"
+	},
+}
+
+func (s *Slack) Name() string {
+	return "slack"
+}
+
+func (s *Slack) Configure(cfg Config) {
+	s.cfg = cfg.Slack
+}
+
+func (s *Slack) Notice(msg Msg, srv any) error {
+	alert := AlertOf(msg, srv)
+	webhook := s.cfg.Webhooks.Of(alert.Service)
+	if channel, ok := ChannelOf(msg); ok {
+		webhook = channel.Webhook
+	}
+	if webhook == "" {
+		return nil
+	}
+	text, err := templates.render(alert, s.Name(), slackDialect)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	body, err := json.Marshal(s.payload(alert, text))
+	if err != nil {
+		return Permanent(err)
+	}
+	resp, err := httpClient.Post(webhook, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("slack status %d: %s", resp.StatusCode, content)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return RetryAfter(err, retryAfterHeader(resp.Header))
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		// invalid payload, revoked or unknown webhook
+		return Permanent(err)
+	default:
+		return err
+	}
+}
+
+func (s *Slack) payload(alert *Alert, text string) map[string]any {
+	title := alert.title()
+	if alert.MentionAll {
+		text = strings.TrimSpace("<!channel>\n" + text)
+	}
+	blocks := []map[string]any{{
+		"type": "header",
+		"text": map[string]any{"type": "plain_text", "text": title},
+	}}
+	if strings.TrimSpace(text) != "" {
+		blocks = append(blocks, map[string]any{
+			"type": "section",
+			"text": map[string]any{"type": "mrkdwn", "text": text},
+		})
+	}
+	return map[string]any{
+		"text": title,
+		"attachments": []map[string]any{{
+			"color":  fmt.Sprintf("#%06X", colorOf(alert.Severity)),
+			"blocks": blocks,
+		}},
+	}
+}
+
+// retryAfterHeader parses the Retry-After header in seconds.
+func retryAfterHeader(header http.Header) time.Duration {
+	seconds, err := strconv.ParseFloat(header.Get("Retry-After"), 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func init() {
+	RegisterNotice(&Slack{})
+}
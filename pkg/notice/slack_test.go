@@ -0,0 +1,69 @@
+package notice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestSlack(t *testing.T) {
+	suite.Run(t, new(SlackTestSuite))
+}
+
+type SlackTestSuite struct {
+	suite.Suite
+
+	server  *httptest.Server
+	payload map[string]any
+	status  int
+	header  http.Header
+	slack   *Slack
+}
+
+func (s *SlackTestSuite) SetupTest() {
+	s.payload = nil
+	s.status = http.StatusOK
+	s.header = http.Header{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.NoError(json.NewDecoder(r.Body).Decode(&s.payload))
+		for k, v := range s.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(s.status)
+	}))
+	s.slack = &Slack{}
+	s.slack.Configure(Config{Slack: SlackConfig{Webhooks: Webhooks{"transfer": s.server.URL}}})
+}
+
+func (s *SlackTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *SlackTestSuite) TestNotice() {
+	s.NoError(s.slack.Notice(testAlert(), nil))
+
+	s.Equal("交易捕获: 1.5 USDT", s.payload["text"])
+	attachment := s.payload["attachments"].([]any)[0].(map[string]any)
+	s.Equal("#E01E5A", attachment["color"])
+	blocks := attachment["blocks"].([]any)
+	s.Len(blocks, 2)
+	section := blocks[1].(map[string]any)["text"].(map[string]any)
+	s.True(strings.HasPrefix(section["text"].(string), "*Tx Hash*\n<https://bscscan.com/tx/0x01|0x01>\n"))
+}
+
+func (s *SlackTestSuite) TestRateLimited() {
+	s.status = http.StatusTooManyRequests
+	s.header.Set("Retry-After", "30")
+	err := s.slack.Notice(testAlert(), nil)
+	s.Equal(30*time.Second, retryAfterOf(err))
+}
+
+func (s *SlackTestSuite) TestNoWebhook() {
+	s.NoError(s.slack.Notice(TextMsg("title"), DummyService("constructor")))
+	s.Nil(s.payload)
+}
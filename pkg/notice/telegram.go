@@ -0,0 +1,166 @@
+package notice
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	TelegramUrl = "https://api.telegram.org"
+
+	TelegramMarkdownV2 = "MarkdownV2"
+)
+
+type TelegramConfig struct {
+	BaseURL  string `koanf:"base_url"`
+	BotToken string `koanf:"bot_token"`
+	// service name -> chat ids, "default" for services not listed
+	Chats map[string][]string `koanf:"chats"`
+}
+
+// ChatsOf returns the chats messages of the service are routed to.
+func (c TelegramConfig) ChatsOf(service string) []string {
+	if chats, ok := c.Chats[service]; ok {
+		return chats
+	}
+	return c.Chats["default"]
+}
+
+type Telegram struct {
+	cfg TelegramConfig
+}
+
+type telegramReq struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode,omitempty"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+type telegramResp struct {
+	Ok          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+func (t *Telegram) Name() string {
+	return "telegram"
+}
+
+func (t *Telegram) Configure(cfg Config) {
+	t.cfg = cfg.Telegram
+	if t.cfg.BaseURL == "" {
+		t.cfg.BaseURL = TelegramUrl
+	}
+}
+
+func (t *Telegram) Notice(msg Msg, srv any) error {
+	if t.cfg.BotToken == "" {
+		return nil
+	}
+	alert := AlertOf(msg, srv)
+	text, err := templates.render(alert, t.Name(), telegramDialect)
+	if err != nil {
+		return Permanent(err)
+	}
+	text = strings.TrimSpace("*" + EscapeMarkdownV2(alert.title()) + "*\n\n" + text)
+	chats := t.cfg.ChatsOf(alert.Service)
+	if channel, ok := ChannelOf(msg); ok {
+		chats = channel.Chats
+	}
+	f := fanOut{kind: "chat"}
+	for _, chatID := range chats {
+		f.add(chatID, t.send(chatID, text))
+	}
+	return f.err(func(failed []string) Msg {
+		return routeToChats(msg, failed)
+	})
+}
+
+// routeToChats routes msg to the chats only, so a retry skips the chats which
+// received it already.
+func routeToChats(msg Msg, chats []string) Msg {
+	routed := &RoutedMsg{Msg: msg, ChannelName: "telegram", Channel: Channel{Notice: "telegram"}}
+	if r, ok := msg.(*RoutedMsg); ok {
+		copied := *r
+		routed = &copied
+	}
+	routed.Channel.Chats = chats
+	return routed
+}
+
+func (t *Telegram) send(chatID string, text string) error {
+	body, err := json.Marshal(telegramReq{
+		ChatID:                chatID,
+		Text:                  text,
+		ParseMode:             TelegramMarkdownV2,
+		DisableWebPagePreview: true,
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+	url := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimSuffix(t.cfg.BaseURL, "/"), t.cfg.BotToken)
+	resp, err := httpClient.Post(url, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var data telegramResp
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return fmt.Errorf("telegram status %d: %w", resp.StatusCode, err)
+	}
+	if data.Ok {
+		return nil
+	}
+	err = fmt.Errorf("telegram error %d: %s", data.ErrorCode, data.Description)
+	switch {
+	case data.ErrorCode == http.StatusTooManyRequests:
+		return RetryAfter(err, time.Duration(data.Parameters.RetryAfter)*time.Second)
+	case data.ErrorCode >= 400 && data.ErrorCode < 500:
+		// malformed message, bad token or chat
+		return Permanent(err)
+	default:
+		return err
+	}
+}
+
+var markdownV2Replacer = func() *strings.Replacer {
+	var pairs []string
+	for _, c := range "\\_*[]()~`>#+-=|{}.!" {
+		pairs = append(pairs, string(c), "\\"+string(c))
+	}
+	return strings.NewReplacer(pairs...)
+}()
+
+// EscapeMarkdownV2 escapes text to be shown verbatim in a MarkdownV2 message.
+func EscapeMarkdownV2(text string) string {
+	return markdownV2Replacer.Replace(text)
+}
+
+// MarkdownV2Link builds a MarkdownV2 inline link.
+func MarkdownV2Link(text string, url string) string {
+	url = strings.NewReplacer(`\`, `\\`, `)`, `\)`).Replace(url)
+	return fmt.Sprintf("[%s](%s)", EscapeMarkdownV2(text), url)
+}
+
+var telegramDialect = dialect{
+	escape: EscapeMarkdownV2,
+	link:   MarkdownV2Link,
+	heading: func(text string) string {
+		return "*" + EscapeMarkdownV2(text) + "*"
+	},
+}
+
+func init() {
+	RegisterNotice(&Telegram{})
+}
@@ -0,0 +1,124 @@
+package notice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestTelegram(t *testing.T) {
+	suite.Run(t, new(TelegramTestSuite))
+}
+
+type TelegramTestSuite struct {
+	suite.Suite
+
+	server   *httptest.Server
+	path     string
+	req      telegramReq
+	status   int
+	response string
+	// chat id -> error code of the chats failing
+	failing  map[string]int
+	chats    []string
+	telegram *Telegram
+}
+
+func (s *TelegramTestSuite) SetupTest() {
+	s.path = ""
+	s.status = http.StatusOK
+	s.response = `{"ok":true}`
+	s.failing = nil
+	s.chats = nil
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.path = r.URL.Path
+		s.NoError(json.NewDecoder(r.Body).Decode(&s.req))
+		s.chats = append(s.chats, s.req.ChatID)
+		if code, ok := s.failing[s.req.ChatID]; ok {
+			w.WriteHeader(code)
+			_, _ = fmt.Fprintf(w, `{"ok":false,"error_code":%d,"description":"failed"}`, code)
+			return
+		}
+		w.WriteHeader(s.status)
+		_, _ = w.Write([]byte(s.response))
+	}))
+
+	s.telegram = &Telegram{}
+	s.telegram.Configure(Config{
+		Telegram: TelegramConfig{
+			BaseURL:  s.server.URL,
+			BotToken: "123:abc",
+			Chats:    map[string][]string{"default": {"-100"}},
+		},
+	})
+}
+
+func (s *TelegramTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *TelegramTestSuite) TestNotice() {
+	s.NoError(s.telegram.Notice(testAlert(), nil))
+	s.Equal("/bot123:abc/sendMessage", s.path)
+	s.Equal("-100", s.req.ChatID)
+	s.Equal("*交易捕获: 1\\.5 USDT*\n"+
+		"\n*Tx Hash*\n[0x01](https://bscscan.com/tx/0x01)\n"+
+		"\n*发款方*\n[0xa](https://bscscan.com/address/0xa)\n"+
+		"\n*关联币种*\n[AAA](https://ave.ai/token/0xb-bsc)\n[BBB](https://ave.ai/token/0xc-bsc)\n"+
+		"\n*金额*\n1\\.5 USDT\n"+
+		"\n*分组*\nmeme", s.req.Text)
+	s.Equal(TelegramMarkdownV2, s.req.ParseMode)
+}
+
+func (s *TelegramTestSuite) TestNoChats() {
+	s.telegram.cfg.Chats = map[string][]string{"constructor": {"-200"}}
+	s.NoError(s.telegram.Notice(testAlert(), nil))
+	s.Empty(s.path)
+}
+
+func (s *TelegramTestSuite) TestRetryAfter() {
+	s.status = http.StatusTooManyRequests
+	s.response = `{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":7}}`
+	err := s.telegram.Notice(TextMsg("msg"), nil)
+	s.Error(err)
+	s.False(IsPermanent(err))
+	s.Equal(7*time.Second, retryAfterOf(err))
+}
+
+func (s *TelegramTestSuite) TestBadRequest() {
+	s.status = http.StatusBadRequest
+	s.response = `{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities"}`
+	err := s.telegram.Notice(TextMsg("msg"), nil)
+	s.True(IsPermanent(err))
+}
+
+func (s *TelegramTestSuite) TestPartialFailure() {
+	s.telegram.cfg.Chats = map[string][]string{"default": {"-100", "-200", "-300"}}
+	s.failing = map[string]int{"-200": http.StatusBadRequest, "-300": http.StatusInternalServerError}
+	err := s.telegram.Notice(TextMsg("msg"), nil)
+	s.Error(err)
+	// one chat failing for good does not give up on the others
+	s.False(IsPermanent(err))
+
+	// retried on the chat failed for now only
+	msg, ok := undeliveredOf(err)
+	s.True(ok)
+	s.chats = nil
+	s.failing = nil
+	s.NoError(s.telegram.Notice(msg, nil))
+	s.Equal([]string{"-300"}, s.chats)
+	s.Contains(s.req.Text, "msg")
+
+	// every chat failed for good
+	s.failing = map[string]int{"-100": http.StatusBadRequest, "-200": http.StatusForbidden, "-300": http.StatusBadRequest}
+	s.True(IsPermanent(s.telegram.Notice(TextMsg("msg"), nil)))
+}
+
+func (s *TelegramTestSuite) TestMarkdownV2Link() {
+	s.Equal(`[a\_b](https://x.com/a_\)b)`, MarkdownV2Link("a_b", "https://x.com/a_)b"))
+}
@@ -0,0 +1,335 @@
+package notice
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	LanguageZh = "zh"
+	LanguageEn = "en"
+
+	// DefaultTemplate is the template key of anything not listed
+	DefaultTemplate = "default"
+)
+
+// TemplateConfig overrides the templates alerts are rendered with. Templates
+// are looked up for the service and notice, the service and any notice, any
+// service and the notice, then any service and any notice. Overrides are
+// checked before "<service>.<notice>.tmpl" files under Dir, with "default"
+// for any, and the built-in templates of Language come last.
+type TemplateConfig struct {
+	// language of the built-in templates, zh or en
+	Language string `koanf:"language"`
+	Dir      string `koanf:"dir"`
+	// service name -> notice name -> template text
+	Overrides map[string]map[string]string `koanf:"overrides"`
+}
+
+// dialect formats the markup a notice renders alerts in.
+type dialect struct {
+	escape  func(text string) string
+	link    func(text string, url string) string
+	heading func(text string) string
+}
+
+// builtinTemplates: language -> service name -> template text
+var builtinTemplates = map[string]map[string]string{
+	LanguageZh: {
+		DefaultTemplate: `{{if .Retracted}}{{heading "该告警已因区块重组回滚"}}
+{{end}}{{range .Card.Fields}}
+{{heading (label .Name)}}
+{{range .Items}}{{if .URL}}{{link .Text .URL}}{{else}}{{escape .Text}}{{end}}
+{{end}}{{end}}`,
+	},
+	LanguageEn: {
+		DefaultTemplate: `{{if .Retracted}}{{heading "Reorged out of the chain"}}
+{{end}}{{if .ID}}
+{{heading (label "alert_id")}}
+{{escape .ID}}
+{{end}}{{if .Block}}
+{{heading (label "block")}}
+{{.Block}}
+{{end}}{{if .TxHash}}
+{{heading (label "tx_hash")}}
+{{txLink .}}
+{{end}}{{range .Addresses}}
+{{heading (label .Label)}}
+{{addressLink $ .}}
+{{end}}{{range .Amounts}}
+{{heading (label .Label)}}
+{{escape .Value}} {{escape .Symbol}}
+{{end}}{{if .Group}}
+{{heading (label "group")}}
+{{escape .Group}}
+{{end}}{{range .Tags}}
+{{heading (label .Name)}}
+{{escape .Value}}
+{{end}}{{range .Links}}
+{{link .Text .URL}}
+{{end}}`,
+	},
+}
+
+// builtinLabels: language -> label -> text, for the titles of alerts, the
+// labels of addresses and amounts, the names of tags and the fields of cards.
+// Labels are language neutral keys, e.g. alert_id, the ones without a text
+// are shown as they are. Texts of titles may be formats, see Labelf.
+var builtinLabels = map[string]map[string]string{
+	LanguageZh: {
+		"alert_id":          "告警编号",
+		"block":             "区块高度",
+		"tx_hash":           "Tx Hash",
+		"group":             "分组",
+		"links":             "链接",
+		"retracted":         "[已回滚] %s",
+		"suppressed":        "另有 %d 条相似告警被抑制: %s",
+		"rate_limited":      "另有 %d 条告警因 %s 限流被抑制",
+		"digest_title":      "告警汇总: %s - %s 共 %d 条",
+		"digest_count":      "%d 条",
+		"digest_total":      "%d 条, %s %s",
+		"quiet_digest":      "静默时段内有 %d 条告警被暂缓",
+		"escalated":         "告警 %s 超过 %s 未确认: %s",
+		"ack":               "确认告警",
+		"acknowledged":      "告警 %s 已确认",
+		"ack_unknown_alert": "告警 %s 不存在或已确认",
+	},
+	LanguageEn: {
+		"alert_id":          "Alert ID",
+		"block":             "Block",
+		"tx_hash":           "Tx Hash",
+		"group":             "Group",
+		"links":             "Links",
+		"retracted":         "[Reorged out] %s",
+		"suppressed":        "%d more similar alerts suppressed: %s",
+		"rate_limited":      "%d more alerts suppressed by the rate limit of %s",
+		"digest_title":      "Digest: %s - %s, %d alerts",
+		"digest_count":      "%d alerts",
+		"digest_total":      "%d alerts, %s %s",
+		"quiet_digest":      "%d alerts held back during quiet hours",
+		"escalated":         "Alert %s not acknowledged in %s: %s",
+		"ack":               "Acknowledge",
+		"acknowledged":      "Alert %s acknowledged",
+		"ack_unknown_alert": "Alert %s is unknown or acknowledged already",
+	},
+}
+
+// RegisterLabels adds the texts of labels in a language, for services to
+// translate the titles and labels of their alerts.
+func RegisterLabels(language string, labels map[string]string) {
+	if builtinLabels[language] == nil {
+		builtinLabels[language] = map[string]string{}
+	}
+	for label, text := range labels {
+		builtinLabels[language][label] = text
+	}
+}
+
+// RegisterTemplate sets the built-in template of a service in a language,
+// for services to ship their default layout.
+func RegisterTemplate(service string, language string, text string) {
+	if builtinTemplates[language] == nil {
+		builtinTemplates[language] = map[string]string{}
+	}
+	builtinTemplates[language][service] = text
+}
+
+// templateSet renders alerts for notices, parsed templates are cached by
+// service and notice.
+type templateSet struct {
+	cfg TemplateConfig
+
+	mu     sync.Mutex
+	parsed map[string]*template.Template
+}
+
+var templates = newTemplateSet(TemplateConfig{})
+
+func newTemplateSet(cfg TemplateConfig) *templateSet {
+	if cfg.Language == "" {
+		cfg.Language = LanguageZh
+	}
+	return &templateSet{
+		cfg:    cfg,
+		parsed: map[string]*template.Template{},
+	}
+}
+
+// source finds the template text of the service for the notice.
+func (t *templateSet) source(service string, notice string) (string, error) {
+	keys := [][2]string{
+		{service, notice},
+		{service, DefaultTemplate},
+		{DefaultTemplate, notice},
+		{DefaultTemplate, DefaultTemplate},
+	}
+	for _, key := range keys {
+		if text, ok := t.cfg.Overrides[key[0]][key[1]]; ok {
+			return text, nil
+		}
+		if t.cfg.Dir == "" {
+			continue
+		}
+		text, err := os.ReadFile(filepath.Join(t.cfg.Dir, key[0]+"."+key[1]+".tmpl"))
+		if err == nil {
+			return string(text), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	builtin := builtinTemplates[t.cfg.Language]
+	if builtin == nil {
+		builtin = builtinTemplates[LanguageZh]
+	}
+	if text, ok := builtin[service]; ok {
+		return text, nil
+	}
+	return builtin[DefaultTemplate], nil
+}
+
+// label returns the text of the label in the language of the templates.
+func (t *templateSet) label(label string) string {
+	if text, ok := builtinLabels[t.cfg.Language][label]; ok {
+		return text
+	}
+	return label
+}
+
+// Label returns the text of the label in the configured language.
+func Label(label string) string {
+	return templates.label(label)
+}
+
+// Labelf formats args with the text of the label in the configured language,
+// e.g. for titles.
+func Labelf(label string, args ...any) string {
+	return fmt.Sprintf(templates.label(label), args...)
+}
+
+func (t *templateSet) template(service string, notice string, d dialect) (*template.Template, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := service + "." + notice
+	if tmpl, ok := t.parsed[key]; ok {
+		return tmpl, nil
+	}
+
+	text, err := t.source(service, notice)
+	if err != nil {
+		return nil, fmt.Errorf("read template %s failed: %w", key, err)
+	}
+	tmpl, err := template.New(key).Funcs(templateFuncs(d, t.label)).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse template %s failed: %w", key, err)
+	}
+	t.parsed[key] = tmpl
+	return tmpl, nil
+}
+
+// render renders the alert with the template of its service for the notice.
+func (t *templateSet) render(alert *Alert, notice string, d dialect) (string, error) {
+	tmpl, err := t.template(alert.Service, notice, d)
+	if err != nil {
+		return "", err
+	}
+	text := bytes.Buffer{}
+	if err := tmpl.Execute(&text, alert); err != nil {
+		return "", fmt.Errorf("render template %s failed: %w", tmpl.Name(), err)
+	}
+	return strings.Trim(text.String(), "\n"), nil
+}
+
+// Shorten abbreviates a hash or an address to its first and last 4 digits.
+func Shorten(hex string) string {
+	if len(hex) <= 12 {
+		return hex
+	}
+	return hex[:6] + "…" + hex[len(hex)-4:]
+}
+
+func templateFuncs(d dialect, label func(string) string) template.FuncMap {
+	return template.FuncMap{
+		"escape":  d.escape,
+		"link":    d.link,
+		"heading": d.heading,
+		"label":   label,
+		"short":   Shorten,
+		"decimal": func(value string, places int32) (string, error) {
+			v, err := decimal.NewFromString(value)
+			if err != nil {
+				return "", err
+			}
+			return v.StringFixed(places), nil
+		},
+		"date": func(t time.Time) string {
+			return t.Format(time.DateTime)
+		},
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"txURL":      (*Alert).TxURL,
+		"addressURL": (*Alert).AddressURL,
+		"txLink": func(a *Alert) string {
+			if url := a.TxURL(); url != "" {
+				return d.link(a.TxHash, url)
+			}
+			return d.escape(a.TxHash)
+		},
+		"addressLink": func(a *Alert, addr Address) string {
+			text := addr.Name
+			if text == "" {
+				text = addr.Address
+			}
+			if url := a.AddressURL(addr); url != "" {
+				return d.link(text, url)
+			}
+			return d.escape(text)
+		},
+		"addresses": func(a *Alert, label string) []Address {
+			var ret []Address
+			for _, addr := range a.Addresses {
+				if addr.Label == label {
+					ret = append(ret, addr)
+				}
+			}
+			return ret
+		},
+		"address": func(a *Alert, label string) Address {
+			for _, addr := range a.Addresses {
+				if addr.Label == label {
+					return addr
+				}
+			}
+			return Address{}
+		},
+		"amount": func(a *Alert, label string) Amount {
+			for _, amount := range a.Amounts {
+				if amount.Label == label {
+					return amount
+				}
+			}
+			return Amount{}
+		},
+		"tag": func(a *Alert, name string) string {
+			for _, tag := range a.Tags {
+				if tag.Name == name {
+					return tag.Value
+				}
+			}
+			return ""
+		},
+	}
+}
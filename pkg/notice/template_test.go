@@ -0,0 +1,127 @@
+package notice
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestTemplate(t *testing.T) {
+	suite.Run(t, new(TemplateTestSuite))
+}
+
+type TemplateTestSuite struct {
+	suite.Suite
+}
+
+func (s *TemplateTestSuite) TearDownTest() {
+	templates = newTemplateSet(TemplateConfig{})
+}
+
+func (s *TemplateTestSuite) render(cfg TemplateConfig, notice string) string {
+	text, err := newTemplateSet(cfg).render(testAlert(), notice, dingtalkDialect)
+	s.NoError(err)
+	return text
+}
+
+func (s *TemplateTestSuite) TestOverrides() {
+	cfg := TemplateConfig{
+		Overrides: map[string]map[string]string{
+			"transfer": {"dingtalk": "transfer dingtalk"},
+			"default":  {"telegram": "default telegram", "default": "default"},
+		},
+	}
+	s.Equal("transfer dingtalk", s.render(cfg, "dingtalk"))
+	s.Equal("default telegram", s.render(cfg, "telegram"))
+	s.Equal("default", s.render(cfg, "slack"))
+}
+
+func (s *TemplateTestSuite) TestDir() {
+	dir := s.T().TempDir()
+	s.NoError(os.WriteFile(filepath.Join(dir, "transfer.default.tmpl"), []byte("from file {{.Title}}"), 0o644))
+	cfg := TemplateConfig{
+		Dir:       dir,
+		Overrides: map[string]map[string]string{"transfer": {"telegram": "inline"}},
+	}
+	s.Equal("from file 交易捕获: 1.5 USDT", s.render(cfg, "dingtalk"))
+	s.Equal("inline", s.render(cfg, "telegram"))
+}
+
+func (s *TemplateTestSuite) TestBuiltin() {
+	s.True(strings.HasPrefix(s.render(TemplateConfig{}, "dingtalk"), "### Tx Hash\n[0x01](https://bscscan.com/tx/0x01)\n"))
+
+	RegisterLabels(LanguageEn, map[string]string{"金额": "Amount"})
+	defer delete(builtinLabels[LanguageEn], "金额")
+	en := s.render(TemplateConfig{Language: LanguageEn}, "dingtalk")
+	s.Contains(en, "### Tx Hash\n[0x01](https://bscscan.com/tx/0x01)")
+	s.Contains(en, "### Amount\n1.5 USDT")
+	// labels without a text
+	s.Contains(en, "### 发款方\n[0xa](https://bscscan.com/address/0xa)")
+}
+
+func (s *TemplateTestSuite) TestLanguage() {
+	RegisterLabels(LanguageZh, map[string]string{"from": "发款方", "amount": "金额"})
+	RegisterLabels(LanguageEn, map[string]string{"from": "From", "amount": "Amount"})
+	defer func() {
+		for _, language := range []string{LanguageZh, LanguageEn} {
+			delete(builtinLabels[language], "from")
+			delete(builtinLabels[language], "amount")
+		}
+	}()
+	alert := func() *Alert {
+		return (&Alert{
+			ID:        "1f",
+			Service:   "transfer",
+			Title:     Labelf("quiet_digest", 2),
+			Chain:     "bsc",
+			Block:     10,
+			TxHash:    "0x01",
+			Group:     "meme",
+			Addresses: []Address{{Label: "from", Address: "0xa"}},
+			Amounts:   []Amount{{Label: "amount", Value: "1.5", Symbol: "USDT"}},
+			Links:     []Link{{Text: Label("ack"), URL: "https://plutus.example.com/ack?id=1f"}},
+		}).Retract()
+	}
+
+	zh := alert()
+	text, err := templates.render(zh, "dingtalk", dingtalkDialect)
+	s.NoError(err)
+	s.Contains(text, "### 区块高度\n10")
+	s.Contains(text, "### 发款方\n[0xa](https://bscscan.com/address/0xa)")
+	s.Equal("[已回滚] 静默时段内有 2 条告警被暂缓", zh.title())
+
+	// nothing is left in Chinese
+	han := regexp.MustCompile(`\p{Han}`)
+	templates = newTemplateSet(TemplateConfig{Language: LanguageEn})
+	en := alert()
+	for notice, d := range map[string]dialect{"dingtalk": dingtalkDialect, "telegram": telegramDialect, "slack": slackDialect} {
+		text, err := templates.render(en, notice, d)
+		s.NoError(err)
+		s.Contains(text, "From")
+		s.False(han.MatchString(text), text)
+	}
+	s.Equal("[Reorged out] 2 alerts held back during quiet hours", en.title())
+	s.False(han.MatchString(en.String()), en.String())
+}
+
+func (s *TemplateTestSuite) TestFuncs() {
+	cfg := TemplateConfig{
+		Overrides: map[string]map[string]string{"default": {"default": `{{short (address . "发款方").Address}} ` +
+			`{{short "0x7A4B173e6Af66cD7a4312a7AE900222f591F403D"}} {{decimal (amount . "金额").Value 3}} ` +
+			`{{tag . "分组"}} {{len (addresses . "关联币种")}} {{addressLink . (index .Addresses 1)}} {{date .Time}}`}},
+	}
+	s.Equal("0xa 0x7A4B…403D 1.500 meme 2 [AAA](https://ave.ai/token/0xb-bsc) 2024-01-02 03:04:05", s.render(cfg, "dingtalk"))
+}
+
+func (s *TemplateTestSuite) TestBrokenTemplate() {
+	templates = newTemplateSet(TemplateConfig{
+		Overrides: map[string]map[string]string{"default": {"default": "{{.Title"}},
+	})
+	err := (&Dingtalk{cfg: DingtalkConfig{Token: "token"}}).Notice(testAlert(), nil)
+	s.Error(err)
+	s.True(IsPermanent(err))
+}
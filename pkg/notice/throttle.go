@@ -0,0 +1,242 @@
+package notice
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDedupKeys identify alerts of the same event
+var DefaultDedupKeys = []string{"service", "tx_hash"}
+
+// ThrottleConfig suppresses alerts similar to one sent within Window, and
+// limits the rate of every notice or channel. Suppressed alerts are summarized once the
+// window ends or the notice has room again.
+type ThrottleConfig struct {
+	// alert fields the dedup key is built from, see fieldValues
+	Keys []string `koanf:"keys"`
+	// dedup is disabled if zero
+	Window time.Duration `koanf:"window"`
+	// notice or channel name -> rate limit
+	Limits map[string]RateLimit `koanf:"limits"`
+}
+
+// RateLimit is a token bucket which refills Rate tokens every Per and holds
+// at most Burst tokens, Rate if not set.
+type RateLimit struct {
+	Rate  int           `koanf:"rate"`
+	Per   time.Duration `koanf:"per"`
+	Burst int           `koanf:"burst"`
+}
+
+type bucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(limit RateLimit, now time.Time) *bucket {
+	if limit.Per <= 0 {
+		limit.Per = time.Minute
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = limit.Rate
+	}
+	return &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+}
+
+// take takes a token if there is one, otherwise returns how long until the
+// next one.
+func (b *bucket) take(now time.Time) (bool, time.Duration) {
+	interval := b.limit.Per / time.Duration(b.limit.Rate)
+	b.tokens += float64(now.Sub(b.last)) / float64(interval)
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) * float64(interval))
+}
+
+// suppressed counts alerts held back, to be summarized later.
+type suppressed struct {
+	alert    *Alert
+	srv      any
+	count    int
+	severity Severity
+	timer    *time.Timer
+	// where a summary goes, and the message routed there
+	notice Notice
+	routed Msg
+}
+
+func (s *suppressed) add(alert *Alert) {
+	s.count++
+	if alert.Severity > s.severity {
+		s.severity = alert.Severity
+	}
+}
+
+// SuppressedMsg summarizes alerts held back by the throttle.
+type SuppressedMsg struct {
+	*Alert
+}
+
+func (m *SuppressedMsg) summarized() *Alert {
+	return m.Alert
+}
+
+// Throttle deduplicates alerts and limits the rate of notices.
+type Throttle struct {
+	cfg ThrottleConfig
+
+	mu sync.Mutex
+	// dedup key -> alerts suppressed within the window
+	seen map[string]*suppressed
+	// notice or channel name -> bucket
+	buckets map[string]*bucket
+	// notice or channel name -> alerts suppressed by the rate limit
+	limited map[string]*suppressed
+}
+
+func NewThrottle(cfg ThrottleConfig) *Throttle {
+	if len(cfg.Keys) == 0 {
+		cfg.Keys = DefaultDedupKeys
+	}
+	return &Throttle{
+		cfg:     cfg,
+		seen:    map[string]*suppressed{},
+		buckets: map[string]*bucket{},
+		limited: map[string]*suppressed{},
+	}
+}
+
+// key builds the dedup key of the alert, retractions never match alerts.
+func (t *Throttle) key(alert *Alert) string {
+	parts := []string{fmt.Sprint(alert.Retracted)}
+	for _, field := range t.cfg.Keys {
+		parts = append(parts, field+"="+strings.Join(fieldValues(alert, field), ","))
+	}
+	return strings.Join(parts, "|")
+}
+
+// Admit reports whether the alert is the first of its key within the window.
+// The others are counted and summarized when the window ends.
+func (t *Throttle) Admit(msg Msg, srv any, broadcast func(msg Msg, srv any)) bool {
+	if t.cfg.Window <= 0 {
+		return true
+	}
+	if _, ok := msg.(summaryMsg); ok {
+		return true
+	}
+	alert := AlertOf(msg, srv)
+	key := t.key(alert)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s, ok := t.seen[key]; ok {
+		s.add(alert)
+		return false
+	}
+	s := &suppressed{alert: alert, srv: srv}
+	t.seen[key] = s
+	s.timer = time.AfterFunc(t.cfg.Window, func() {
+		t.mu.Lock()
+		delete(t.seen, key)
+		t.mu.Unlock()
+		if s.count > 0 {
+			broadcast(t.dedupSummary(s), srv)
+		}
+	})
+	return true
+}
+
+func (t *Throttle) dedupSummary(s *suppressed) *SuppressedMsg {
+	summary := *s.alert
+	summary.Title = Labelf("suppressed", s.count, s.alert.Title)
+	if s.severity > summary.Severity {
+		summary.Severity = s.severity
+	}
+	summary.Time = time.Now()
+	return &SuppressedMsg{&summary}
+}
+
+// Allow reports whether the notice, or the channel the message is routed to,
+// has room for the message. Messages over the limit are counted and
+// summarized to the same destination once it has room again.
+func (t *Throttle) Allow(n Notice, msg Msg, srv any) bool {
+	name := destination(n, msg)
+	limit, ok := t.cfg.Limits[name]
+	if !ok || limit.Rate <= 0 {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	b, ok := t.buckets[name]
+	if !ok {
+		b = newBucket(limit, now)
+		t.buckets[name] = b
+	}
+	allowed, wait := b.take(now)
+	if allowed {
+		return true
+	}
+
+	if s, ok := t.limited[name]; ok {
+		s.add(AlertOf(msg, srv))
+		return false
+	}
+	s := &suppressed{notice: n, routed: msg}
+	s.add(AlertOf(msg, srv))
+	t.limited[name] = s
+	s.timer = time.AfterFunc(wait, func() {
+		t.mu.Lock()
+		delete(t.limited, name)
+		// the summary takes the token it waited for
+		b.take(time.Now())
+		t.mu.Unlock()
+		_ = n.Notice(t.limitSummary(name, s), nil)
+	})
+	return false
+}
+
+func (t *Throttle) limitSummary(name string, s *suppressed) Msg {
+	return reroute(&SuppressedMsg{&Alert{
+		Severity: s.severity,
+		Title:    Labelf("rate_limited", s.count, name),
+		Time:     time.Now(),
+	}}, s.routed)
+}
+
+// Flush sends the pending summaries right away.
+func (t *Throttle) Flush(broadcast func(msg Msg, srv any)) {
+	t.mu.Lock()
+	var seen []*suppressed
+	for key, s := range t.seen {
+		if s.timer.Stop() && s.count > 0 {
+			seen = append(seen, s)
+		}
+		delete(t.seen, key)
+	}
+	limited := map[string]*suppressed{}
+	for name, s := range t.limited {
+		if s.timer.Stop() {
+			limited[name] = s
+		}
+		delete(t.limited, name)
+	}
+	t.mu.Unlock()
+
+	for _, s := range seen {
+		broadcast(t.dedupSummary(s), s.srv)
+	}
+	for name, s := range limited {
+		_ = s.notice.Notice(t.limitSummary(name, s), nil)
+	}
+}
@@ -0,0 +1,149 @@
+package notice
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestThrottle(t *testing.T) {
+	suite.Run(t, new(ThrottleTestSuite))
+}
+
+// RecordingNotice remembers every message it is noticed of.
+type RecordingNotice struct {
+	mu   sync.Mutex
+	msgs []Msg
+}
+
+func (n *RecordingNotice) Name() string {
+	return "recording"
+}
+
+func (n *RecordingNotice) Notice(msg Msg, srv any) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.msgs = append(n.msgs, msg)
+	return nil
+}
+
+func (n *RecordingNotice) Msgs() []Msg {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Msg(nil), n.msgs...)
+}
+
+type ThrottleTestSuite struct {
+	suite.Suite
+
+	notice *RecordingNotice
+}
+
+func (s *ThrottleTestSuite) SetupTest() {
+	s.notice = &RecordingNotice{}
+}
+
+func (s *ThrottleTestSuite) alert(txHash string) *Alert {
+	alert := testAlert()
+	alert.TxHash = txHash
+	return alert
+}
+
+func (s *ThrottleTestSuite) TestDedup() {
+	t := NewThrottle(ThrottleConfig{Window: 50 * time.Millisecond})
+	broadcast := func(msg Msg, srv any) {
+		_ = s.notice.Notice(msg, srv)
+	}
+
+	s.True(t.Admit(s.alert("0x01"), nil, broadcast))
+	s.False(t.Admit(s.alert("0x01"), nil, broadcast))
+	s.False(t.Admit(s.alert("0x01"), nil, broadcast))
+	s.True(t.Admit(s.alert("0x02"), nil, broadcast))
+	s.True(t.Admit(s.alert("0x01").Retract(), nil, broadcast))
+
+	s.Eventually(func() bool { return len(s.notice.Msgs()) == 1 }, time.Second, 10*time.Millisecond)
+	summary := s.notice.Msgs()[0].(*SuppressedMsg)
+	s.Equal("另有 2 条相似告警被抑制: 交易捕获: 1.5 USDT", summary.Title)
+	s.Equal("0x01", summary.TxHash)
+
+	// a new window starts after the last one ended
+	s.True(t.Admit(s.alert("0x01"), nil, broadcast))
+}
+
+func (s *ThrottleTestSuite) TestDedupKeys() {
+	t := NewThrottle(ThrottleConfig{Window: time.Minute, Keys: []string{"address:发款方", "tag:分组"}})
+	s.True(t.Admit(s.alert("0x01"), nil, nil))
+	s.False(t.Admit(s.alert("0x02"), nil, nil))
+
+	alert := s.alert("0x03")
+	alert.Tags = nil
+	s.True(t.Admit(alert, nil, nil))
+}
+
+func (s *ThrottleTestSuite) TestRateLimit() {
+	t := NewThrottle(ThrottleConfig{
+		Limits: map[string]RateLimit{"recording": {Rate: 2, Per: 200 * time.Millisecond}},
+	})
+	s.True(t.Allow(s.notice, s.alert("0x01"), nil))
+	s.True(t.Allow(s.notice, s.alert("0x02"), nil))
+	s.False(t.Allow(s.notice, s.alert("0x03"), nil))
+	s.False(t.Allow(s.notice, TextMsg("msg"), nil))
+	s.True(t.Allow(&DummyNotice{}, s.alert("0x04"), nil))
+
+	s.Eventually(func() bool { return len(s.notice.Msgs()) == 1 }, time.Second, 10*time.Millisecond)
+	summary := s.notice.Msgs()[0].(*SuppressedMsg)
+	s.Equal("另有 2 条告警因 recording 限流被抑制", summary.Title)
+	s.Equal(SeverityCritical, summary.Severity)
+}
+
+func (s *ThrottleTestSuite) TestRateLimitChannel() {
+	t := NewThrottle(ThrottleConfig{
+		Limits: map[string]RateLimit{"group-a": {Rate: 1, Per: 200 * time.Millisecond}},
+	})
+	routed := func(channel string, msg Msg) Msg {
+		return &RoutedMsg{Msg: msg, ChannelName: channel, Channel: Channel{Notice: "recording"}}
+	}
+	s.True(t.Allow(s.notice, routed("group-a", s.alert("0x01")), nil))
+	s.False(t.Allow(s.notice, routed("group-a", s.alert("0x02")), nil))
+	s.True(t.Allow(s.notice, routed("group-b", s.alert("0x03")), nil))
+	s.True(t.Allow(s.notice, s.alert("0x04"), nil))
+
+	s.Eventually(func() bool { return len(s.notice.Msgs()) == 1 }, time.Second, 10*time.Millisecond)
+	summary := s.notice.Msgs()[0].(*RoutedMsg)
+	s.Equal("group-a", summary.ChannelName)
+	s.Equal("另有 1 条告警因 group-a 限流被抑制", AlertOf(summary, nil).Title)
+}
+
+func (s *ThrottleTestSuite) TestFlush() {
+	t := NewThrottle(ThrottleConfig{
+		Window: time.Minute,
+		Limits: map[string]RateLimit{"recording": {Rate: 1, Per: time.Minute}},
+	})
+	broadcast := func(msg Msg, srv any) {
+		_ = s.notice.Notice(msg, srv)
+	}
+	s.True(t.Admit(s.alert("0x01"), nil, broadcast))
+	s.False(t.Admit(s.alert("0x01"), nil, broadcast))
+	s.True(t.Allow(s.notice, s.alert("0x01"), nil))
+	s.False(t.Allow(s.notice, s.alert("0x02"), nil))
+
+	t.Flush(broadcast)
+	msgs := s.notice.Msgs()
+	s.Len(msgs, 2)
+	s.Equal("另有 1 条相似告警被抑制: 交易捕获: 1.5 USDT", msgs[0].(*SuppressedMsg).Title)
+	s.Equal("另有 1 条告警因 recording 限流被抑制", msgs[1].(*SuppressedMsg).Title)
+}
+
+func (s *ThrottleTestSuite) TestBucket() {
+	now := time.Now()
+	b := newBucket(RateLimit{Rate: 20, Per: time.Minute, Burst: 1}, now)
+	ok, _ := b.take(now)
+	s.True(ok)
+	ok, wait := b.take(now)
+	s.False(ok)
+	s.Equal(3*time.Second, wait)
+	ok, _ = b.take(now.Add(3 * time.Second))
+	s.True(ok)
+}
@@ -0,0 +1,108 @@
+package notice
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"text/template"
+	"time"
+)
+
+func checkURL(key string, value string) error {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("%s: %q is not a http/https url", key, value)
+	}
+	return nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate reports every problem of the config, keys are named from notice.
+func (c Config) Validate() error {
+	var errs []error
+	errs = append(errs,
+		checkURL("notice.dingtalk.base_url", c.Dingtalk.BaseURL),
+		checkURL("notice.telegram.base_url", c.Telegram.BaseURL),
+		checkURL("notice.policy.ack.url", c.Policy.Ack.URL),
+	)
+	for _, service := range sortedKeys(c.Slack.Webhooks) {
+		errs = append(errs, checkURL("notice.slack.webhooks."+service, c.Slack.Webhooks[service]))
+	}
+	for _, service := range sortedKeys(c.Discord.Webhooks) {
+		errs = append(errs, checkURL("notice.discord.webhooks."+service, c.Discord.Webhooks[service]))
+	}
+
+	endpoints := map[string]bool{}
+	for i, e := range c.Webhook.Endpoints {
+		key := fmt.Sprintf("notice.webhook.endpoints[%d]", i)
+		if e.Name == "" {
+			errs = append(errs, fmt.Errorf("%s.name: is required", key))
+		} else if endpoints[e.Name] {
+			errs = append(errs, fmt.Errorf("%s.name: duplicate endpoint %s", key, e.Name))
+		}
+		endpoints[e.Name] = true
+		if e.URL == "" {
+			errs = append(errs, fmt.Errorf("%s.url: is required", key))
+		}
+		errs = append(errs, checkURL(key+".url", e.URL))
+		if _, err := template.New(e.Name).Funcs(webhookFuncs).Parse(e.Body); err != nil {
+			errs = append(errs, fmt.Errorf("%s.body: %w", key, err))
+		}
+	}
+
+	for _, name := range sortedKeys(c.Channels) {
+		channel, key := c.Channels[name], "notice.channels."+name
+		if findNotice(channel.Notice) == nil {
+			errs = append(errs, fmt.Errorf("%s.notice: unknown notice %q", key, channel.Notice))
+		}
+		errs = append(errs, checkURL(key+".webhook", channel.Webhook))
+		for _, endpoint := range channel.Endpoints {
+			if !endpoints[endpoint] {
+				errs = append(errs, fmt.Errorf("%s.endpoints: unknown webhook endpoint %q", key, endpoint))
+			}
+		}
+	}
+	for i, route := range c.Routes {
+		for _, name := range route.Channels {
+			if _, ok := c.Channels[name]; !ok {
+				errs = append(errs, fmt.Errorf("notice.routes[%d].channels: unknown channel %q", i, name))
+			}
+		}
+	}
+
+	if c.Policy.Timezone != "" {
+		if _, err := time.LoadLocation(c.Policy.Timezone); err != nil {
+			errs = append(errs, fmt.Errorf("notice.policy.timezone: %w", err))
+		}
+	}
+	for _, name := range sortedKeys(c.Policy.QuietHours) {
+		hours, key := c.Policy.QuietHours[name], "notice.policy.quiet_hours."+name
+		if _, err := parseClock(hours.Start); err != nil {
+			errs = append(errs, fmt.Errorf("%s.start: %q is not a time of day like 23:00", key, hours.Start))
+		}
+		if _, err := parseClock(hours.End); err != nil {
+			errs = append(errs, fmt.Errorf("%s.end: %q is not a time of day like 08:00", key, hours.End))
+		}
+	}
+	if c.Policy.Ack.Listen != "" && c.Policy.Ack.Token == "" {
+		errs = append(errs, errors.New("notice.policy.ack.token: is required to listen for acknowledgements"))
+	}
+	for _, name := range c.Policy.Escalation.Channels {
+		if _, ok := c.Channels[name]; !ok {
+			errs = append(errs, fmt.Errorf("notice.policy.escalation.channels: unknown channel %q", name))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,42 @@
+package notice
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	saved := notices
+	notices = []Notice{&RecordingNotice{}}
+	defer func() { notices = saved }()
+
+	assert.NoError(t, Config{
+		Channels: map[string]Channel{"ops": {Notice: "recording"}},
+		Routes:   []Route{{Channels: []string{"ops"}}},
+	}.Validate())
+
+	err := Config{
+		Slack: SlackConfig{Webhooks: Webhooks{"default": "hooks.slack.com"}},
+		Webhook: WebhookConfig{Endpoints: []WebhookEndpoint{
+			{Name: "risk", URL: "https://risk.example.com", Body: "{{.Title"},
+			{Name: "risk"},
+		}},
+		Channels: map[string]Channel{"ops": {Notice: "recording", Endpoints: []string{"audit"}}},
+		Policy: PolicyConfig{
+			Timezone:   "Mars/Olympus",
+			QuietHours: map[string]QuietHours{"ops": {Start: "23:00", End: "8am"}},
+			Escalation: EscalationConfig{Channels: []string{"oncall"}},
+			Ack:        AckConfig{Listen: ":8080"},
+		},
+	}.Validate()
+	assert.EqualError(t, err, `notice.slack.webhooks.default: "hooks.slack.com" is not a http/https url
+notice.webhook.endpoints[0].body: template: risk:1: unclosed action
+notice.webhook.endpoints[1].name: duplicate endpoint risk
+notice.webhook.endpoints[1].url: is required
+notice.channels.ops.endpoints: unknown webhook endpoint "audit"
+notice.policy.timezone: unknown time zone Mars/Olympus
+notice.policy.quiet_hours.ops.end: "8am" is not a time of day like 08:00
+notice.policy.ack.token: is required to listen for acknowledgements
+notice.policy.escalation.channels: unknown channel "oncall"`)
+}
@@ -0,0 +1,177 @@
+package notice
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultWebhookMethod          = http.MethodPost
+	DefaultWebhookBody            = "{{json .}}"
+	DefaultWebhookSignatureHeader = "X-Plutus-Signature"
+)
+
+type WebhookConfig struct {
+	Endpoints []WebhookEndpoint `koanf:"endpoints"`
+}
+
+type WebhookEndpoint struct {
+	Name    string            `koanf:"name"`
+	URL     string            `koanf:"url"`
+	Method  string            `koanf:"method"`
+	Headers map[string]string `koanf:"headers"`
+	// text/template executed on the Alert
+	Body string `koanf:"body"`
+	// if set, the body is signed with HMAC-SHA256 as "sha256=<hex>"
+	Secret          string `koanf:"secret"`
+	SignatureHeader string `koanf:"signature_header"`
+	// services posted to the endpoint, all if empty
+	Services []string `koanf:"services"`
+}
+
+func (e WebhookEndpoint) accepts(service string) bool {
+	if len(e.Services) == 0 {
+		return true
+	}
+	for _, s := range e.Services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+type webhookEndpoint struct {
+	WebhookEndpoint
+	body *template.Template
+}
+
+// Webhook posts messages to arbitrary http endpoints, with the body rendered
+// from a template.
+type Webhook struct {
+	endpoints []webhookEndpoint
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+func (w *Webhook) Configure(cfg Config) {
+	w.endpoints = nil
+	for _, e := range cfg.Webhook.Endpoints {
+		if e.Method == "" {
+			e.Method = DefaultWebhookMethod
+		}
+		if e.Body == "" {
+			e.Body = DefaultWebhookBody
+		}
+		if e.SignatureHeader == "" {
+			e.SignatureHeader = DefaultWebhookSignatureHeader
+		}
+		body, err := template.New(e.Name).Funcs(webhookFuncs).Parse(e.Body)
+		if err != nil {
+			log.Errorf("webhook %s disabled, parse body template failed: %v", e.Name, err)
+			continue
+		}
+		w.endpoints = append(w.endpoints, webhookEndpoint{e, body})
+	}
+}
+
+// Notice posts to every endpoint accepting the service, or to the endpoints
+// of the channel the message is routed to. Only the endpoints which failed
+// are retried.
+func (w *Webhook) Notice(msg Msg, srv any) error {
+	alert := AlertOf(msg, srv)
+	channel, routed := ChannelOf(msg)
+	f := fanOut{kind: "webhook"}
+	for _, e := range w.endpoints {
+		if routed && !contains(channel.Endpoints, e.Name) || !routed && !e.accepts(alert.Service) {
+			continue
+		}
+		f.add(e.Name, e.post(alert))
+	}
+	return f.err(func(failed []string) Msg {
+		return routeToEndpoints(msg, failed)
+	})
+}
+
+// routeToEndpoints routes msg to the endpoints only, so a retry skips the
+// endpoints which received it already.
+func routeToEndpoints(msg Msg, endpoints []string) Msg {
+	routed := &RoutedMsg{Msg: msg, ChannelName: "webhook", Channel: Channel{Notice: "webhook"}}
+	if r, ok := msg.(*RoutedMsg); ok {
+		copied := *r
+		routed = &copied
+	}
+	routed.Channel.Endpoints = endpoints
+	return routed
+}
+
+// sign returns the signature of body as "sha256=<hex>".
+func (e webhookEndpoint) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(e.Secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (e webhookEndpoint) post(alert *Alert) error {
+	body := bytes.Buffer{}
+	if err := e.body.Execute(&body, alert); err != nil {
+		return Permanent(err)
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(e.Method), e.URL, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	if e.Secret != "" {
+		req.Header.Set(e.SignatureHeader, e.sign(body.Bytes()))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("status %d: %s", resp.StatusCode, content)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return RetryAfter(err, retryAfterHeader(resp.Header))
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return Permanent(err)
+	default:
+		return err
+	}
+}
+
+func init() {
+	RegisterNotice(&Webhook{})
+}
@@ -0,0 +1,144 @@
+package notice
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestWebhook(t *testing.T) {
+	suite.Run(t, new(WebhookTestSuite))
+}
+
+type webhookReq struct {
+	method string
+	header http.Header
+	body   string
+}
+
+type WebhookTestSuite struct {
+	suite.Suite
+
+	server  *httptest.Server
+	reqs    []webhookReq
+	status  int
+	webhook *Webhook
+}
+
+func (s *WebhookTestSuite) SetupTest() {
+	s.reqs = nil
+	s.status = http.StatusOK
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.reqs = append(s.reqs, webhookReq{r.Method, r.Header, string(body)})
+		w.WriteHeader(s.status)
+	}))
+	s.webhook = &Webhook{}
+}
+
+func (s *WebhookTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *WebhookTestSuite) configure(endpoints ...WebhookEndpoint) {
+	s.webhook.Configure(Config{Webhook: WebhookConfig{Endpoints: endpoints}})
+}
+
+func (s *WebhookTestSuite) TestTemplate() {
+	s.configure(WebhookEndpoint{
+		Name:    "bot",
+		URL:     s.server.URL,
+		Method:  "put",
+		Headers: map[string]string{"Authorization": "Bearer abc"},
+		Body:    `{"text": {{json .Title}}, "amount": "{{(index .Amounts 0).Value}}", "severity": "{{.Severity}}", "service": "{{.Service}}"}`,
+	})
+	alert := testAlert()
+	alert.Title = `say "hi"`
+	s.NoError(s.webhook.Notice(alert, nil))
+
+	s.Len(s.reqs, 1)
+	s.Equal(http.MethodPut, s.reqs[0].method)
+	s.Equal("Bearer abc", s.reqs[0].header.Get("Authorization"))
+	s.Empty(s.reqs[0].header.Get(DefaultWebhookSignatureHeader))
+	s.JSONEq(`{"text": "say \"hi\"", "amount": "1.5", "severity": "critical", "service": "transfer"}`, s.reqs[0].body)
+}
+
+func (s *WebhookTestSuite) TestDefaultBodyAndSignature() {
+	s.configure(WebhookEndpoint{Name: "risk", URL: s.server.URL, Secret: "secret"})
+	s.NoError(s.webhook.Notice(TextMsg("title"), DummyService("transfer")))
+
+	s.Len(s.reqs, 1)
+	s.Equal(http.MethodPost, s.reqs[0].method)
+	s.Contains(s.reqs[0].body, `"title":"title"`)
+	s.Contains(s.reqs[0].body, `"severity":"info"`)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(s.reqs[0].body))
+	s.Equal("sha256="+hex.EncodeToString(mac.Sum(nil)), s.reqs[0].header.Get(DefaultWebhookSignatureHeader))
+}
+
+func (s *WebhookTestSuite) TestServices() {
+	s.configure(
+		WebhookEndpoint{Name: "transfer", URL: s.server.URL, Services: []string{"transfer"}},
+		WebhookEndpoint{Name: "constructor", URL: s.server.URL, Services: []string{"constructor"}},
+	)
+	s.NoError(s.webhook.Notice(TextMsg("title"), DummyService("transfer")))
+	s.Len(s.reqs, 1)
+
+	s.NoError(s.webhook.Notice(TextMsg("title"), DummyService("balance")))
+	s.Len(s.reqs, 1)
+}
+
+func (s *WebhookTestSuite) TestInvalidTemplate() {
+	s.configure(WebhookEndpoint{Name: "broken", URL: s.server.URL, Body: "{{.Title"})
+	s.NoError(s.webhook.Notice(TextMsg("title"), DummyService("transfer")))
+	s.Empty(s.reqs)
+}
+
+func (s *WebhookTestSuite) TestErrors() {
+	s.configure(WebhookEndpoint{Name: "risk", URL: s.server.URL})
+
+	s.status = http.StatusBadRequest
+	err := s.webhook.Notice(TextMsg("title"), DummyService("transfer"))
+	s.Error(err)
+	s.True(IsPermanent(err))
+
+	s.status = http.StatusBadGateway
+	err = s.webhook.Notice(TextMsg("title"), DummyService("transfer"))
+	s.Error(err)
+	s.False(IsPermanent(err))
+}
+
+func (s *WebhookTestSuite) TestPartialFailure() {
+	var paths []string
+	failing := map[string]int{"/audit": http.StatusBadRequest, "/risk": http.StatusBadGateway}
+	s.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if status, ok := failing[r.URL.Path]; ok {
+			w.WriteHeader(status)
+		}
+	})
+	s.configure(
+		WebhookEndpoint{Name: "ok", URL: s.server.URL + "/ok"},
+		WebhookEndpoint{Name: "audit", URL: s.server.URL + "/audit"},
+		WebhookEndpoint{Name: "risk", URL: s.server.URL + "/risk"},
+	)
+	err := s.webhook.Notice(TextMsg("title"), DummyService("transfer"))
+	s.Error(err)
+	// one endpoint failing for good does not give up on the others
+	s.False(IsPermanent(err))
+
+	// retried on the endpoint failed for now only
+	msg, ok := undeliveredOf(err)
+	s.True(ok)
+	paths = nil
+	failing = nil
+	s.NoError(s.webhook.Notice(msg, DummyService("transfer")))
+	s.Equal([]string{"/risk"}, paths)
+}
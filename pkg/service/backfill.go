@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+
+	"plutus/pkg/app"
+)
+
+const DefaultBackfillRange = 5000
+
+// progress tracks the last fully processed block of a service and persists it
+// to the app checkpoint, if there is one. It advances with the head blocks,
+// never with events, which may arrive out of order.
+type progress struct {
+	name       string
+	checkpoint app.Checkpoint
+	// blocks are only done once they have enough confirmations
+	depth uint64
+	// every block <= done has been fully processed
+	done uint64
+	// first block with an event failed to be handled, blocks from it on are
+	// not done until it is handled
+	failed uint64
+}
+
+func (b *BaseService) newProgress(name string, depth uint64) *progress {
+	return &progress{
+		name:       name,
+		checkpoint: b.Checkpoint,
+		depth:      depth,
+	}
+}
+
+func (p *progress) save(block uint64) error {
+	if p.failed != 0 && block >= p.failed {
+		block = p.failed - 1
+	}
+	if block <= p.done {
+		return nil
+	}
+	p.done = block
+	if p.checkpoint == nil {
+		return nil
+	}
+	return p.checkpoint.Save(p.name, block)
+}
+
+// processed reports whether events of the block have been handled already,
+// e.g. by the backfill.
+func (p *progress) processed(block uint64) bool {
+	return p.done != 0 && block <= p.done
+}
+
+// confirmed marks the blocks whose events are all handled at the head block
+// as done: the blocks confirmed at the head, or without confirmations the
+// blocks before the head, as events of the head block may still arrive.
+func (p *progress) confirmed(head uint64) error {
+	margin := p.depth
+	if margin == 0 {
+		margin = 1
+	}
+	if head < margin {
+		return nil
+	}
+	return p.save(head - margin)
+}
+
+// backfill replays the blocks missed since the last checkpoint up to the
+// current head by calling fn with consecutive block ranges. It must be called
+// after the live subscription is established, so no block falls in between.
+func (b *BaseService) backfill(ctx context.Context, p *progress, fn func(opts *bind.FilterOpts) error) error {
+	if p.checkpoint == nil {
+		return nil
+	}
+	head, err := b.Client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("get block number failed: %w", err)
+	}
+
+	last, ok := p.checkpoint.Load(p.name)
+	if !ok {
+		// first run, the live subscription covers the head block
+		return p.confirmed(head)
+	}
+	p.done = last
+
+	chunk := uint64(DefaultBackfillRange)
+	if b.cfg != nil && b.cfg.BackfillRange > 0 {
+		chunk = b.cfg.BackfillRange
+	}
+	for from := last + 1; from <= head; from += chunk {
+		to := from + chunk - 1
+		if to > head {
+			to = head
+		}
+		b.log.Infof("backfill block %d - %d", from, to)
+		err := fn(&bind.FilterOpts{
+			Start:   from,
+			End:     &to,
+			Context: ctx,
+		})
+		if err != nil {
+			return fmt.Errorf("backfill block %d - %d failed: %w", from, to, err)
+		}
+		// events of unconfirmed blocks are still pending
+		done := to
+		if done+p.depth > head {
+			done = 0
+			if head > p.depth {
+				done = head - p.depth
+			}
+		}
+		if err := p.save(done); err != nil {
+			return fmt.Errorf("save checkpoint failed: %w", err)
+		}
+	}
+	return nil
+}
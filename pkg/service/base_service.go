@@ -1,19 +1,50 @@
 package service
 
 import (
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/core/types"
 	log "github.com/sirupsen/logrus"
 
 	"plutus/pkg/app"
 	"plutus/pkg/notice"
 )
 
+// AlertedCacheSize is the number of alerts remembered for retraction
+const AlertedCacheSize = 1024
+
 type BaseService struct {
 	*app.Status
 	log *log.Entry
 	cfg *app.Config
+	// log key -> message alerted for the event
+	alerted *lru.Cache[app.LogKey, notice.Msg]
 }
 
 func (b *BaseService) BroadCast(msg notice.Msg, srv any) {
 	b.log.Infof("broadcast: %s", msg)
 	notice.BroadCast(msg, srv)
 }
+
+// alert broadcasts msg for the event of the log and remembers it, so it can
+// be retracted if the log is reorged out.
+func (b *BaseService) alert(log types.Log, msg notice.Msg, srv any) {
+	if b.alerted == nil {
+		b.alerted = lru.NewCache[app.LogKey, notice.Msg](AlertedCacheSize)
+	}
+	b.alerted.Add(app.KeyOf(log), msg)
+	b.BroadCast(msg, srv)
+}
+
+// retract follows up the alert of a removed log, if one was sent.
+func (b *BaseService) retract(log types.Log, srv any) {
+	if b.alerted == nil {
+		return
+	}
+	key := app.KeyOf(log)
+	msg, ok := b.alerted.Get(key)
+	if !ok {
+		return
+	}
+	b.alerted.Remove(key)
+	b.BroadCast(&notice.RetractedMsg{Msg: msg}, srv)
+}
@@ -3,6 +3,9 @@ package service
 import (
 	"context"
 	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/agiledragon/gomonkey/v2"
@@ -14,12 +17,48 @@ import (
 	"plutus/pkg/notice"
 )
 
-// exec "anvil --fork-url=https://bscrpc.com" before unit tests
+// exec "anvil --fork-url=https://bscrpc.com" before unit tests, unless the
+// fixtures of the tests are recorded in FixtureDir
 const AnvilEndpoint = "ws://127.0.0.1:8545"
 
+// set RecordEnv to record the fixtures of the tests from anvil, and
+// RequireFixturesEnv, e.g. in CI, to fail the tests missing theirs rather than
+// skip them
+const (
+	FixtureDir         = "testdata"
+	RecordEnv          = "PLUTUS_RECORD"
+	RequireFixturesEnv = "PLUTUS_REQUIRE_FIXTURES"
+)
+
 func (s *baseTestSuite) getAnvilClient() *ethclient.Client {
 	client, err := ethclient.Dial(AnvilEndpoint)
-	s.NoError(err)
+	s.Require().NoError(err)
+	return client
+}
+
+func (s *baseTestSuite) fixturePath() string {
+	name := strings.ReplaceAll(s.T().Name(), "/", "_")
+	return filepath.Join(FixtureDir, name+".json")
+}
+
+// getClient replays the recorded fixture of the test if there is one, and
+// falls back to anvil otherwise. The test is skipped if there is neither,
+// unless fixtures are required.
+func (s *baseTestSuite) getClient() app.Client {
+	if os.Getenv(RecordEnv) != "" {
+		s.recorder = app.NewRecordingClient(s.getAnvilClient())
+		return s.recorder
+	}
+	if replay, err := app.LoadReplayClient(s.fixturePath()); err == nil {
+		return replay
+	}
+	client, err := ethclient.Dial(AnvilEndpoint)
+	if err != nil && os.Getenv(RequireFixturesEnv) != "" {
+		s.T().Fatalf("no fixture %s, record it with make record", s.fixturePath())
+	}
+	if err != nil {
+		s.T().Skipf("no fixture %s and anvil is not reachable: %s", s.fixturePath(), err)
+	}
 	return client
 }
 
@@ -27,10 +66,14 @@ type baseTestSuite struct {
 	suite.Suite
 
 	client        *app.SimulatedClient
+	recorder      *app.RecordingClient
 	bscscanClient *etherscan.Client
 	patch         *gomonkey.Patches
 	noticeMsg     notice.Msg
 	srv           app.Service
+	// served by the stubbed BscScan, and the address they were asked for
+	transfers   []etherscan.ERC20Transfer
+	transfersOf string
 }
 
 func (s *baseTestSuite) SetupTest() {
@@ -39,14 +82,29 @@ func (s *baseTestSuite) SetupTest() {
 		s.noticeMsg = msg
 	})
 
-	s.client = app.NewSimulatedClient(s.getAnvilClient(), nil)
 	s.bscscanClient = etherscan.New(etherscan.Mainnet, "")
+	s.patch.ApplyMethodFunc(s.bscscanClient, "ERC20Transfers",
+		func(_, address *string, _, _ *int, _, _ int, _ bool) ([]etherscan.ERC20Transfer, error) {
+			s.transfersOf = *address
+			return s.transfers, nil
+		})
+
+	s.client = app.NewSimulatedClient(s.getClient(), nil)
 }
 
 func (s *baseTestSuite) TearDownTest() {
+	if s.recorder != nil {
+		s.NoError(os.MkdirAll(FixtureDir, 0o755))
+		s.NoError(s.recorder.Save(s.fixturePath()))
+		s.recorder = nil
+	}
 	s.patch.Reset()
 	s.noticeMsg = nil
-	s.client.Close()
+	s.transfers, s.transfersOf = nil, ""
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
 }
 
 func (s *baseTestSuite) ReplayBlockWithRun(blockHeight int64) {
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"plutus/pkg/app"
+	"plutus/pkg/common/fingerprint"
+)
+
+// useConfig loads the config of the test from a temporary config.yaml.
+func useConfig(t *testing.T, content string) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	app.SetConfigFile(path)
+	t.Cleanup(func() {
+		app.SetConfigFile("")
+	})
+}
+
+func TestConstructorValidateConfig(t *testing.T) {
+	useConfig(t, `
+services:
+  constructor:
+    config:
+      tokens:
+        A:
+          - "0x5aef33e31e8ab838570652a5a96e5f2fa7aa9b15"
+      groups:
+        A:
+          bytecode_weight: 1
+          abi_weight: -1
+          threshold: 1.5
+        B:
+          abi_weight: 1
+      watch: blocks`)
+
+	v := app.NewValidator()
+	NewConstructorListener().ValidateConfig(v)
+	assert.EqualError(t, v.Err(), `services.constructor.config.groups.A.abi_weight: must not be negative
+services.constructor.config.groups.A.threshold: must be between 0 and 1
+services.constructor.config.groups.B: unknown token group
+services.constructor.config.watch: "blocks" is not one of pairs, creations or all`)
+}
+
+func TestConstructorReload(t *testing.T) {
+	useConfig(t, `
+services:
+  constructor:
+    config:
+      watch: all
+      trace_internal: true`)
+
+	c := NewConstructorListener()
+	c.log = logrus.NewEntry(logrus.New())
+	assert.NoError(t, c.Reload(&app.Config{}))
+	assert.True(t, c.config().TraceInternal)
+	assert.Len(t, c.resubscribe, 1)
+
+	// watching the same
+	<-c.resubscribe
+	assert.NoError(t, c.Reload(&app.Config{}))
+	assert.Len(t, c.resubscribe, 0)
+}
+
+// downNode fails every request for code.
+type downNode struct {
+	app.Client
+}
+
+func (n *downNode) CodeAt(context.Context, common.Address, *big.Int) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestConstructorReloadFailure(t *testing.T) {
+	useConfig(t, `
+services:
+  constructor:
+    config:
+      tokens:
+        A:
+          - "0x5aef33e31e8ab838570652a5a96e5f2fa7aa9b15"`)
+
+	token := "0x5aef33e31e8ab838570652a5a96e5f2fa7aa9b15"
+	f := fingerprint.New([]byte{0x60, 0x80, 0x60, 0x40})
+	c := NewConstructorListener()
+	c.log = logrus.NewEntry(logrus.New())
+	c.Status = &app.Status{Client: &downNode{}}
+	c.fingerprints[token] = f
+	c.tokenGroup[token] = "A"
+
+	// the previous fingerprint is kept while the node is down
+	assert.NoError(t, c.Reload(&app.Config{}))
+	assert.Same(t, f, c.fingerprints[token])
+	assert.Equal(t, "A", c.tokenGroup[token])
+}
+
+func TestTransferValidateConfig(t *testing.T) {
+	useConfig(t, `
+services:
+  transfer:
+    config:
+      wallets:
+        - "0x95D4ce9cF81AB59E3607Db4de46BD576A4ED3018"
+        - "0x95d4ce9cf81ab59e3607db4de46bd576a4ed301"
+      threshold_value: 2k
+      warning_value: "10000.5"
+      critical_value: "1000"`)
+
+	v := app.NewValidator()
+	NewTransferListener().ValidateConfig(v)
+	assert.EqualError(t, v.Err(), `services.transfer.config.wallets[1]: "0x95d4ce9cf81ab59e3607db4de46bd576a4ed301" is not an address
+services.transfer.config.threshold_value: "2k" is not a decimal
+services.transfer.config.critical_value: is below warning_value`)
+}
+
+func TestTransferReload(t *testing.T) {
+	useConfig(t, `
+services:
+  transfer:
+    config:
+      wallets:
+        - "0x95D4ce9cF81AB59E3607Db4de46BD576A4ED3018"
+      threshold_value: "2000"`)
+
+	srv := NewTransferListener()
+	srv.log = logrus.NewEntry(logrus.New())
+	srv.srvCfg = &TransferConfig{Wallets: []string{"0x95d4ce9cf81ab59e3607db4de46bd576a4ed3018"}}
+	assert.NoError(t, srv.Reload(&app.Config{}))
+	assert.Equal(t, "2000", srv.config().ThresholdValue)
+	assert.Len(t, srv.resubscribe, 0)
+
+	// watching other wallets
+	srv.srvCfg = &TransferConfig{}
+	assert.NoError(t, srv.Reload(&app.Config{}))
+	assert.Len(t, srv.resubscribe, 1)
+
+	// watching the same
+	<-srv.resubscribe
+	assert.NoError(t, srv.Reload(&app.Config{}))
+	assert.Len(t, srv.resubscribe, 0)
+}
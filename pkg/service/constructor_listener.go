@@ -3,71 +3,246 @@ package service
 import (
 	"context"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
-	"github.com/antlabs/strsim"
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	log "github.com/sirupsen/logrus"
 
 	"plutus/pkg/app"
 	"plutus/pkg/common/address"
 	"plutus/pkg/common/book"
+	"plutus/pkg/common/fingerprint"
 	"plutus/pkg/notice"
 )
 
+const (
+	constructorTemplateZh = `{{if .Retracted}}{{heading "该事件已因区块重组回滚"}}
+
+{{end}}通知时间: {{escape (date .Time)}}
+
+区块高度: {{.Block}}
+
+合约地址 {{addressLink . (address . "contract")}}
+{{with tag . "proxy_kind"}}
+合约为 {{escape .}} 代理, 实现合约 {{addressLink $ (address $ "implementation")}}
+{{end}}
+与 {{addressLink . (address . "similar_contract")}}{{escape (printf "(%s)" .Group)}} 相似, 相似度 {{escape (tag . "score")}}
+{{with addresses . "runner_ups"}}
+其他相似合约:
+{{range .}}{{escape "- "}}{{addressLink $ .}}
+{{end}}{{end}}
+事件 Hash: {{txLink .}}`
+
+	constructorTemplateEn = `{{if .Retracted}}{{heading "The event was reorged out of the chain"}}
+
+{{end}}Time: {{escape (date .Time)}}
+
+Block: {{.Block}}
+
+Contract {{addressLink . (address . "contract")}}
+{{with tag . "proxy_kind"}}
+The contract is a {{escape .}} proxy of {{addressLink $ (address $ "implementation")}}
+{{end}}
+Similar to {{addressLink . (address . "similar_contract")}} {{escape (printf "(%s)" .Group)}}, score {{escape (tag . "score")}}
+{{with addresses . "runner_ups"}}
+Runner-ups:
+{{range .}}{{escape "- "}}{{addressLink $ .}}
+{{end}}{{end}}
+Tx Hash: {{txLink .}}`
+)
+
 type ConstructorListener struct {
 	BaseService
 	srvCfg *ConstructorConfig
-	// token address -> byte code
-	byteCodes map[string]string
+	// guards the fingerprints, replaced as a whole on reload
+	mu sync.RWMutex
+	// token address -> fingerprint of its code
+	fingerprints map[string]*fingerprint.Fingerprint
 	// token address -> token group
 	tokenGroup map[string]string
+	// Run returns on changes of what is watched, to be run again
+	resubscribe chan struct{}
 
 	factory *book.PancakeFactoryV2
 }
 
+// CreationsCheckpointSuffix names the checkpoint of the blocks scanned for
+// contract creations, after the service name
+const CreationsCheckpointSuffix = ".creations"
+
+// What the constructor listener watches
+const (
+	// PairCreated events of PancakeSwap V2
+	WatchPairs = "pairs"
+	// every contract created, at deployment
+	WatchCreations = "creations"
+	WatchAll       = "all"
+)
+
 type ConstructorConfig struct {
 	// token group -> token addresses
 	Tokens map[string][]string `koanf:"tokens"`
+	// token group -> how tokens are compared with the group
+	Groups map[string]GroupConfig `koanf:"groups"`
+	// WatchPairs, WatchCreations or WatchAll, WatchPairs if empty
+	Watch string `koanf:"watch"`
+	// also watch contracts created by contracts, traced by
+	// debug_traceBlockByNumber if the node supports it
+	TraceInternal bool `koanf:"trace_internal"`
+}
+
+func (cfg *ConstructorConfig) watch() string {
+	if cfg.Watch == "" {
+		return WatchPairs
+	}
+	return cfg.Watch
+}
+
+// GroupConfig weighs the similarity of the bytecode and of the ABI surface,
+// the function selectors and event topics, in the score of a token. Tokens
+// are compared by their bytecode alone if both are zero.
+type GroupConfig struct {
+	BytecodeWeight float64 `koanf:"bytecode_weight"`
+	ABIWeight      float64 `koanf:"abi_weight"`
+	// score from which a token is a clone of a token of the group,
+	// DefaultSimilarity if zero
+	Threshold float64 `koanf:"threshold"`
+}
+
+func (g GroupConfig) threshold() float64 {
+	if g.Threshold == 0 {
+		return DefaultSimilarity
+	}
+	return g.Threshold
+}
+
+func (g GroupConfig) weights() fingerprint.Weights {
+	return fingerprint.Weights{Bytecode: g.BytecodeWeight, ABI: g.ABIWeight}
 }
 
 func NewConstructorListener() *ConstructorListener {
 	c := &ConstructorListener{
-		srvCfg:     &ConstructorConfig{},
-		byteCodes:  map[string]string{},
-		tokenGroup: map[string]string{},
+		srvCfg:       &ConstructorConfig{},
+		fingerprints: map[string]*fingerprint.Fingerprint{},
+		tokenGroup:   map[string]string{},
+		resubscribe:  make(chan struct{}, 1),
 	}
 	return c
 }
 
+func (c *ConstructorListener) config() *ConstructorConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.srvCfg
+}
+
 func (c *ConstructorListener) Name() string {
 	return "constructor"
 }
 
-func (c *ConstructorListener) getByteCode(token string) (string, error) {
-	byteCode, err := c.Client.CodeAt(context.Background(), common.HexToAddress(token), nil)
+// getFingerprint fingerprints the code of the token, of its implementation if
+// it is a proxy, which is returned too.
+func (c *ConstructorListener) getFingerprint(token string) (*fingerprint.Fingerprint, *Proxy, error) {
+	ctx := context.Background()
+	byteCode, err := c.Client.CodeAt(ctx, common.HexToAddress(token), nil)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
-	return string(byteCode), nil
+	proxy, byteCode, err := resolveProxy(ctx, c.Client, common.HexToAddress(token), byteCode)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fingerprint.New(byteCode), proxy, nil
 }
 
-func (c *ConstructorListener) PreRun() {
-	c.tokenGroup = map[string]string{}
-	c.byteCodes = map[string]string{}
-	for group, tokens := range c.srvCfg.Tokens {
+// fingerprintTokens fingerprints the tokens of every group. A token that
+// fails to be fingerprinted keeps its previous fingerprint.
+func (c *ConstructorListener) fingerprintTokens(cfg *ConstructorConfig) (map[string]*fingerprint.Fingerprint, map[string]string) {
+	tokenGroup := map[string]string{}
+	fingerprints := map[string]*fingerprint.Fingerprint{}
+	for group, tokens := range cfg.Tokens {
 		for i := range tokens {
 			token := tokens[i]
-			byteCode, err := c.getByteCode(token)
+			f, proxy, err := c.getFingerprint(token)
 			if err != nil {
 				c.log.WithField("token", token).Warnf("get byteCode failed: %s", err)
+				c.mu.RLock()
+				f = c.fingerprints[token]
+				c.mu.RUnlock()
+				if f != nil {
+					tokenGroup[token] = group
+					fingerprints[token] = f
+				}
+				continue
+			}
+			if f == nil {
+				c.log.WithField("token", token).Warn("token has no code")
 				continue
 			}
-			c.tokenGroup[token] = group
-			c.byteCodes[token] = string(byteCode)
+			if proxy != nil {
+				c.log.WithField("token", token).
+					WithField("implementation", proxy.Implementation).
+					Infof("token is a %s proxy, its implementation is fingerprinted", proxy.Kind)
+			}
+			tokenGroup[token] = group
+			fingerprints[token] = f
+		}
+	}
+	return fingerprints, tokenGroup
+}
+
+func (c *ConstructorListener) PreRun() {
+	fingerprints, tokenGroup := c.fingerprintTokens(c.config())
+	c.mu.Lock()
+	c.fingerprints, c.tokenGroup = fingerprints, tokenGroup
+	c.mu.Unlock()
+}
+
+// Reload recomputes the fingerprints of the new token groups, events are
+// compared against the old ones until they are ready. Changes of what is
+// watched run the listener again.
+func (c *ConstructorListener) Reload(config *app.Config) error {
+	srvCfg := &ConstructorConfig{}
+	if err := app.LoadServiceConfig(c.Name(), srvCfg); err != nil {
+		return err
+	}
+	fingerprints, tokenGroup := c.fingerprintTokens(srvCfg)
+
+	c.mu.Lock()
+	var added, removed []string
+	for token, group := range tokenGroup {
+		if _, ok := c.tokenGroup[token]; !ok {
+			added = append(added, group+":"+token)
 		}
 	}
+	for token, group := range c.tokenGroup {
+		if _, ok := tokenGroup[token]; !ok {
+			removed = append(removed, group+":"+token)
+		}
+	}
+	rewatch := c.srvCfg.watch() != srvCfg.watch()
+	c.srvCfg = srvCfg
+	c.fingerprints, c.tokenGroup = fingerprints, tokenGroup
+	c.mu.Unlock()
+
+	if rewatch {
+		select {
+		case c.resubscribe <- struct{}{}:
+		default:
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	c.log.WithField("added tokens", added).
+		WithField("removed tokens", removed).
+		Info("Reloaded")
+	return nil
 }
 
 func (c *ConstructorListener) WatchEvent(sink chan *book.PancakeFactoryV2PairCreated) (ethereum.Subscription, error) {
@@ -77,6 +252,48 @@ func (c *ConstructorListener) WatchEvent(sink chan *book.PancakeFactoryV2PairCre
 func (c *ConstructorListener) Run(ctx context.Context) error {
 	c.PreRun()
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var runs []func(ctx context.Context) error
+	switch c.config().watch() {
+	case WatchPairs:
+		runs = append(runs, c.runPairs)
+	case WatchCreations:
+		runs = append(runs, c.runCreations)
+	default:
+		runs = append(runs, c.runPairs, c.runCreations)
+	}
+	errs := make(chan error, len(runs))
+	for _, run := range runs {
+		go func(run func(ctx context.Context) error) {
+			errs <- run(ctx)
+		}(run)
+	}
+
+	// the first to end stops the others
+	var err error
+	pending := len(runs)
+	select {
+	case err = <-errs:
+		pending--
+	case <-c.resubscribe:
+		c.log.Info("Watch changed, running again")
+	}
+	cancel()
+	for ; pending > 0; pending-- {
+		<-errs
+	}
+	return err
+}
+
+// runPairs handles the PairCreated events of PancakeSwap V2.
+func (c *ConstructorListener) runPairs(ctx context.Context) error {
+	pipe := newPipeline(&c.BaseService, c.Name(),
+		func(e *book.PancakeFactoryV2PairCreated) types.Log { return e.Raw },
+		c.handleLogged,
+		func(e *book.PancakeFactoryV2PairCreated) { c.retract(e.Raw, c) },
+	)
+
 	sink := make(chan *book.PancakeFactoryV2PairCreated)
 	sub, err := c.WatchEvent(sink)
 	if err != nil {
@@ -84,23 +301,132 @@ func (c *ConstructorListener) Run(ctx context.Context) error {
 	}
 	defer sub.Unsubscribe()
 
+	heads := make(chan *types.Header)
+	headSub, err := pipe.watchHeads(ctx, c.Client, heads)
+	if err != nil {
+		return fmt.Errorf("head watch failed: %w", err)
+	}
+	defer headSub.Unsubscribe()
+
+	err = c.backfill(ctx, pipe.progress, func(opts *bind.FilterOpts) error {
+		it, err := c.factory.FilterPairCreated(opts, []common.Address{}, []common.Address{})
+		if err != nil {
+			return err
+		}
+		defer it.Close()
+		for it.Next() {
+			pipe.push(it.Event)
+		}
+		return it.Error()
+	})
+	if err != nil {
+		return err
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 		case err := <-sub.Err():
 			return fmt.Errorf("subscription error: %w", err)
+		case err := <-headSub.Err():
+			return fmt.Errorf("head subscription error: %w", err)
+		case head := <-heads:
+			if err := pipe.confirm(head); err != nil {
+				c.log.Warnf("save checkpoint failed: %s", err)
+			}
 		case event := <-sink:
-			err := c.handle(event)
-			if err != nil {
-				c.log.WithField("tx hash", event.Raw.TxHash).Errorf("handle failed: %s", err)
+			pipe.push(event)
+		}
+	}
+}
+
+// runCreations handles the contracts created in every block.
+func (c *ConstructorListener) runCreations(ctx context.Context) error {
+	var depth uint64
+	if c.cfg != nil {
+		depth = c.cfg.Services[c.Name()].Confirmations
+	}
+	scanner := c.newCreationScanner(c.Name()+CreationsCheckpointSuffix, depth,
+		func() bool { return c.config().TraceInternal },
+		c.handleCreation,
+	)
+
+	heads := make(chan *types.Header)
+	sub, err := c.Client.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		return fmt.Errorf("head watch failed: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-sub.Err():
+			return fmt.Errorf("head subscription error: %w", err)
+		case head := <-heads:
+			if err := scanner.scan(ctx, head.Number.Uint64()); err != nil {
+				c.log.Warnf("scan creations failed: %s", err)
 			}
 		}
 	}
 }
 
-func (c *ConstructorListener) similar(codeA string, codeB string) bool {
-	return strsim.Compare(string(codeA), string(codeB)) >= 0.8
+func (c *ConstructorListener) handleLogged(event *book.PancakeFactoryV2PairCreated) error {
+	err := c.handle(event)
+	if err != nil {
+		c.log.WithField("tx hash", event.Raw.TxHash).Errorf("handle failed: %s", err)
+	}
+	return err
+}
+
+// DefaultSimilarity is the score from which a token is taken as a clone of a
+// reference token, unless its group has a threshold
+const DefaultSimilarity = 0.8
+
+// MaxRunnerUps is how many matches besides the best one an alert lists
+const MaxRunnerUps = 3
+
+// match is a token scoring above the threshold against a reference token.
+type match struct {
+	token     string
+	reference string
+	group     string
+	score     float64
+}
+
+// similar scores a token against a reference token of the group, by the
+// weights of the group, and reports whether it is a clone.
+func (c *ConstructorListener) similar(a *fingerprint.Fingerprint, b *fingerprint.Fingerprint, group string) (float64, bool) {
+	c.mu.RLock()
+	groupCfg := c.srvCfg.Groups[group]
+	c.mu.RUnlock()
+	score := a.Score(b, groupCfg.weights())
+	return score, score >= groupCfg.threshold()
+}
+
+// matches compares the token against every reference token, the best match
+// first.
+func (c *ConstructorListener) matches(token string, f *fingerprint.Fingerprint) []match {
+	c.mu.RLock()
+	fingerprints, tokenGroup := c.fingerprints, c.tokenGroup
+	c.mu.RUnlock()
+
+	var ret []match
+	for reference, referenceFingerprint := range fingerprints {
+		group := tokenGroup[reference]
+		if score, ok := c.similar(f, referenceFingerprint, group); ok {
+			ret = append(ret, match{token: token, reference: reference, group: group, score: score})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].score != ret[j].score {
+			return ret[i].score > ret[j].score
+		}
+		return ret[i].reference < ret[j].reference
+	})
+	return ret
 }
 
 func (c *ConstructorListener) handle(event *book.PancakeFactoryV2PairCreated) error {
@@ -108,74 +434,138 @@ func (c *ConstructorListener) handle(event *book.PancakeFactoryV2PairCreated) er
 		WithField("tx hash", event.Raw.TxHash)
 
 	token0 := event.Token0.Hex()
-	byteCode0, err := c.getByteCode(token0)
+	fingerprint0, proxy0, err := c.getFingerprint(token0)
 	if err != nil {
 		log.WithField("token0", common.HexToAddress(token0)).Errorf("get bytecode failed: %s", err)
 		return fmt.Errorf("get %s bytecode failed: %w", token0, err)
 	}
 
 	token1 := event.Token1.Hex()
-	byteCode1, err := c.getByteCode(token1)
+	fingerprint1, proxy1, err := c.getFingerprint(token1)
 	if err != nil {
 		log.WithField("token0", common.HexToAddress(token1)).Errorf("get bytecode failed: %s", err)
 		return fmt.Errorf("get %s bytecode failed: %w", token1, err)
 	}
 
-	for addr := range c.byteCodes {
-		needHandle := false
-		token := token0
-		if c.similar(string(byteCode0), c.byteCodes[addr]) {
-			needHandle = true
-			token = token0
-		} else if c.similar(string(byteCode1), c.byteCodes[addr]) {
-			needHandle = true
-			token = token1
-		}
-
-		if needHandle {
-			c.BroadCast(notice.TextMsg(fmt.Sprintf(c.msgTemplate(),
-				time.Now().Format(time.DateTime),
-				event.Raw.BlockNumber,
-				common.HexToAddress(token),
-				addr,
-				c.tokenGroup[addr],
-				event.Raw.TxHash,
-			)), c)
-
-			return nil
-		}
+	// the pair is reported for the token matching best, with the other
+	// references it matches
+	found, proxy := c.matches(token0, fingerprint0), proxy0
+	if found1 := c.matches(token1, fingerprint1); len(found1) > 0 && (len(found) == 0 || found1[0].score > found[0].score) {
+		found, proxy = found1, proxy1
 	}
+	if len(found) == 0 {
+		return nil
+	}
+	c.alert(event.Raw, c.report(notice.Label("pair_title"), found, proxy, event.Raw.BlockNumber, event.Raw.TxHash), c)
 	return nil
 }
 
-func (c *ConstructorListener) msgTemplate() string {
-	return `
-通知时间: %s
+// handleCreation alerts on a created contract similar to a reference token.
+func (c *ConstructorListener) handleCreation(creation Creation) error {
+	log := c.log.
+		WithField("tx hash", creation.TxHash).
+		WithField("contract", creation.Contract)
 
-区块高度: %d
+	token := creation.Contract.Hex()
+	f, proxy, err := c.getFingerprint(token)
+	if err != nil {
+		log.Errorf("get bytecode failed: %s", err)
+		return fmt.Errorf("get %s bytecode failed: %w", token, err)
+	}
+	found := c.matches(token, f)
+	if len(found) == 0 {
+		return nil
+	}
+	c.BroadCast(c.report(notice.Label("creation_title"), found, proxy, creation.Block, creation.TxHash), c)
+	return nil
+}
 
-合约地址 %s
+// report describes the best match of a token and the runner-ups.
+func (c *ConstructorListener) report(title string, found []match, proxy *Proxy, block uint64, txHash common.Hash) *notice.Alert {
+	best := found[0]
+	c.log.WithField("tx hash", txHash).
+		WithField("token", best.token).
+		WithField("reference", best.reference).
+		WithField("score", best.score).
+		Info("Similar token found")
+
+	alert := &notice.Alert{
+		Service:  c.Name(),
+		Severity: notice.SeverityCritical,
+		Title:    title,
+		Time:     time.Now(),
+		Chain:    "bsc",
+		Block:    block,
+		TxHash:   txHash.Hex(),
+		Group:    best.group,
+		Addresses: []notice.Address{
+			{Label: "contract", Address: common.HexToAddress(best.token).Hex()},
+			{Label: "similar_contract", Address: best.reference},
+		},
+		Tags: []notice.Tag{{Name: "score", Value: fmt.Sprintf("%.2f", best.score)}},
+	}
+	if proxy != nil {
+		alert.Addresses = append(alert.Addresses, notice.Address{Label: "implementation", Address: proxy.Implementation.Hex()})
+		alert.Tags = append(alert.Tags, notice.Tag{Name: "proxy_kind", Value: proxy.Kind})
+	}
+	for i, m := range found[1:] {
+		if i == MaxRunnerUps {
+			break
+		}
+		alert.Addresses = append(alert.Addresses, notice.Address{
+			Label:   "runner_ups",
+			Address: m.reference,
+			Name:    fmt.Sprintf("%s (%s, %.2f)", m.reference, m.group, m.score),
+		})
+	}
+	return alert
+}
 
-与 %s(%s) 相似
+// ValidateConfig checks the tokens of every group are addresses, the weights
+// and thresholds of the groups and what is watched.
+func (c *ConstructorListener) ValidateConfig(v *app.Validator) {
+	var cfg ConstructorConfig
+	v, ok := app.ValidateServiceConfig(v, c.Name(), &cfg)
+	if !ok {
+		return
+	}
+	groups := make([]string, 0, len(cfg.Tokens))
+	for group := range cfg.Tokens {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		for i, token := range cfg.Tokens[group] {
+			v.Address(fmt.Sprintf("tokens.%s[%d]", group, i), token)
+		}
+	}
 
-事件 Hash: %s`
-}
+	groups = groups[:0]
+	for group := range cfg.Groups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		groupCfg := cfg.Groups[group]
+		if _, ok := cfg.Tokens[group]; !ok {
+			v.Errorf("groups."+group, "unknown token group")
+		}
+		if groupCfg.BytecodeWeight < 0 {
+			v.Errorf("groups."+group+".bytecode_weight", "must not be negative")
+		}
+		if groupCfg.ABIWeight < 0 {
+			v.Errorf("groups."+group+".abi_weight", "must not be negative")
+		}
+		if groupCfg.Threshold < 0 || groupCfg.Threshold > 1 {
+			v.Errorf("groups."+group+".threshold", "must be between 0 and 1")
+		}
+	}
 
-func (c *ConstructorListener) DingtalkMsg(msg notice.Msg) (string, string) {
-	token := c.cfg.DingtalkToken
-	json := `{
-	  "msgtype": "markdown",
-	  "markdown": {
-		"title": "上链检测",
-		"text": "%s"
-	  },
-	  "at": {
-		"atMobiles": [],
-		"atUserIds": [],
-		"isAtAll": false
-	  }
-	}`
-	return token, fmt.Sprintf(json, msg)
+	switch cfg.Watch {
+	case "", WatchPairs, WatchCreations, WatchAll:
+	default:
+		v.Errorf("watch", "%q is not one of %s, %s or %s", cfg.Watch, WatchPairs, WatchCreations, WatchAll)
+	}
 }
 
 func (c *ConstructorListener) Init(config *app.Config, status *app.Status, log *log.Entry) error {
@@ -200,4 +590,26 @@ func (c *ConstructorListener) Init(config *app.Config, status *app.Status, log *
 
 func init() {
 	app.RegisterService(NewConstructorListener())
+	notice.RegisterTemplate("constructor", notice.LanguageZh, constructorTemplateZh)
+	notice.RegisterTemplate("constructor", notice.LanguageEn, constructorTemplateEn)
+	notice.RegisterLabels(notice.LanguageZh, map[string]string{
+		"pair_title":       "上链检测",
+		"creation_title":   "部署检测",
+		"contract":         "合约地址",
+		"similar_contract": "相似合约",
+		"implementation":   "实现合约",
+		"runner_ups":       "其他相似合约",
+		"score":            "相似度",
+		"proxy_kind":       "代理类型",
+	})
+	notice.RegisterLabels(notice.LanguageEn, map[string]string{
+		"pair_title":       "Pair created",
+		"creation_title":   "Contract deployed",
+		"contract":         "Contract",
+		"similar_contract": "Similar Contract",
+		"implementation":   "Implementation",
+		"runner_ups":       "Runner-ups",
+		"score":            "Score",
+		"proxy_kind":       "Proxy Kind",
+	})
 }
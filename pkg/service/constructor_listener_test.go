@@ -8,15 +8,45 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 
 	"plutus/pkg/app"
+	"plutus/pkg/common/fingerprint"
 )
 
 func TestConstructorLisenter(t *testing.T) {
 	suite.Run(t, new(ConstructorListenerTestSuite))
 }
 
+// similarTo returns a fingerprint scoring score against base by bytecode.
+func similarTo(base *fingerprint.Fingerprint, score float64) *fingerprint.Fingerprint {
+	f := *base
+	for i := int(score * fingerprint.SignatureSize); i < fingerprint.SignatureSize; i++ {
+		f.Signature[i]++
+	}
+	return &f
+}
+
+func TestConstructorMatches(t *testing.T) {
+	token := &fingerprint.Fingerprint{Size: 1}
+	c := NewConstructorListener()
+	c.srvCfg.Groups = map[string]GroupConfig{"B": {Threshold: 0.5}}
+	c.fingerprints = map[string]*fingerprint.Fingerprint{
+		"0xa1": similarTo(token, 0.75),
+		"0xa2": similarTo(token, 0.875),
+		"0xb1": similarTo(token, 0.5),
+		"0xb2": similarTo(token, 0.25),
+	}
+	c.tokenGroup = map[string]string{"0xa1": "A", "0xa2": "A", "0xb1": "B", "0xb2": "B"}
+
+	assert.Equal(t, []match{
+		{token: "0xt", reference: "0xa2", group: "A", score: 0.875},
+		{token: "0xt", reference: "0xb1", group: "B", score: 0.5},
+	}, c.matches("0xt", token))
+	assert.Empty(t, c.matches("0xt", nil))
+}
+
 type ConstructorListenerTestSuite struct {
 	baseTestSuite
 
@@ -66,7 +96,9 @@ func (s *ConstructorListenerTestSuite) TestSimilar() {
 	codeB, err := s.client.CodeAt(context.Background(), common.HexToAddress(b), nil)
 	s.NoError(err)
 
-	s.True(s.srv.(*ConstructorListener).similar(string(codeA), string(codeB)))
+	score, ok := s.srv.(*ConstructorListener).similar(fingerprint.New(codeA), fingerprint.New(codeB), s.group)
+	s.True(ok)
+	s.GreaterOrEqual(score, DefaultSimilarity)
 }
 
 func (s *ConstructorListenerTestSuite) TestHandle() {
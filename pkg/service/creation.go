@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+
+	"plutus/pkg/app"
+)
+
+// Creation is a contract created in a block.
+type Creation struct {
+	Contract common.Address
+	Block    uint64
+	TxHash   common.Hash
+	// created by a contract rather than by the transaction itself
+	Internal bool
+}
+
+// blockCreations returns the contracts created by the transactions of the
+// block, from the receipts of the transactions without a recipient.
+func blockCreations(ctx context.Context, client app.Client, block *types.Block) ([]Creation, error) {
+	var ret []Creation
+	for _, tx := range block.Transactions() {
+		if tx.To() != nil {
+			continue
+		}
+		receipt, err := client.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("get receipt of %s failed: %w", tx.Hash(), err)
+		}
+		if receipt.Status != types.ReceiptStatusSuccessful || receipt.ContractAddress == (common.Address{}) {
+			continue
+		}
+		ret = append(ret, Creation{
+			Contract: receipt.ContractAddress,
+			Block:    block.NumberU64(),
+			TxHash:   tx.Hash(),
+		})
+	}
+	return ret, nil
+}
+
+// callFrame is a call traced by the callTracer.
+type callFrame struct {
+	Type  string         `json:"type"`
+	To    common.Address `json:"to"`
+	Error string         `json:"error"`
+	Calls []callFrame    `json:"calls"`
+}
+
+// txTrace is the trace of a transaction by debug_traceBlockByNumber, in the
+// order of the transactions of the block. Older nodes leave TxHash out.
+type txTrace struct {
+	TxHash common.Hash `json:"txHash"`
+	Result callFrame   `json:"result"`
+}
+
+// created collects the contracts created by the calls under frame, calls
+// which reverted created nothing.
+func (f callFrame) created(ret []common.Address) []common.Address {
+	for _, call := range f.Calls {
+		if call.Error != "" {
+			continue
+		}
+		if call.Type == "CREATE" || call.Type == "CREATE2" {
+			ret = append(ret, call.To)
+		}
+		ret = call.created(ret)
+	}
+	return ret
+}
+
+// tracedCreations returns the contracts created by contracts in the block,
+// traced by debug_traceBlockByNumber, which the node may not support.
+func tracedCreations(ctx context.Context, client app.Client, block *types.Block) ([]Creation, error) {
+	var traces []txTrace
+	err := app.CallContext(ctx, client, &traces, "debug_traceBlockByNumber",
+		hexutil.EncodeUint64(block.NumberU64()), map[string]any{"tracer": "callTracer"})
+	if err != nil {
+		return nil, fmt.Errorf("trace block %d failed: %w", block.NumberU64(), err)
+	}
+	txs := block.Transactions()
+	var ret []Creation
+	for i, trace := range traces {
+		if trace.Result.Error != "" {
+			continue
+		}
+		txHash := trace.TxHash
+		if txHash == (common.Hash{}) && i < len(txs) {
+			txHash = txs[i].Hash()
+		}
+		for _, contract := range trace.Result.created(nil) {
+			ret = append(ret, Creation{
+				Contract: contract,
+				Block:    block.NumberU64(),
+				TxHash:   txHash,
+				Internal: true,
+			})
+		}
+	}
+	return ret, nil
+}
+
+// maxTraceAttempts is how many heads a block whose trace fails is retried on
+// before it is scanned without the contracts created by contracts
+const maxTraceAttempts = 3
+
+// creationScanner hands the contracts created in every confirmed block to
+// handle, resuming from the checkpoint. Blocks are only scanned once
+// confirmed, so nothing is reorged out after it is handled. A block with a
+// creation failed to be handled is scanned again on the next head.
+type creationScanner struct {
+	*progress
+	client app.Client
+	log    *log.Entry
+	// most blocks scanned on a head, catching up takes several heads
+	maxRange uint64
+	// next block to scan, from the first head if 0
+	next uint64
+	// whether contracts created by contracts are traced too
+	trace func() bool
+	// the node not supporting traces was warned about
+	traceWarned bool
+	// failed traces of the next block
+	traceFailures int
+	// creations of the next block handled already, before one failed
+	handled int
+	handle  func(Creation) error
+}
+
+func (b *BaseService) newCreationScanner(name string, depth uint64, trace func() bool, handle func(Creation) error) *creationScanner {
+	s := &creationScanner{
+		progress: b.newProgress(name, depth),
+		client:   b.Client,
+		log:      b.log,
+		maxRange: DefaultBackfillRange,
+		trace:    trace,
+		handle:   handle,
+	}
+	if b.cfg != nil && b.cfg.BackfillRange > 0 {
+		s.maxRange = b.cfg.BackfillRange
+	}
+	if s.checkpoint != nil {
+		if last, ok := s.checkpoint.Load(name); ok {
+			s.done = last
+			s.next = last + 1
+		}
+	}
+	return s
+}
+
+// scan handles the creations of the blocks confirmed at head which were not
+// scanned yet, up to maxRange of them.
+func (s *creationScanner) scan(ctx context.Context, head uint64) error {
+	if head < s.depth {
+		return nil
+	}
+	to := head - s.depth
+	if s.next == 0 {
+		s.next = to
+	}
+	if s.next > to {
+		return nil
+	}
+	if to-s.next >= s.maxRange {
+		to = s.next + s.maxRange - 1
+		s.log.Infof("scan creations of block %d - %d", s.next, to)
+	}
+	for ; s.next <= to; s.next++ {
+		if err := s.scanBlock(ctx, s.next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *creationScanner) scanBlock(ctx context.Context, number uint64) error {
+	block, err := s.client.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return fmt.Errorf("get block %d failed: %w", number, err)
+	}
+	creations, err := blockCreations(ctx, s.client, block)
+	if err != nil {
+		return err
+	}
+	if s.trace() {
+		internal, err := s.traced(ctx, block)
+		if err != nil {
+			return err
+		}
+		creations = append(creations, internal...)
+	}
+	for ; s.handled < len(creations); s.handled++ {
+		if err := s.handle(creations[s.handled]); err != nil {
+			return fmt.Errorf("handle creation of %s failed: %w", creations[s.handled].Contract, err)
+		}
+	}
+	s.traceFailures, s.handled = 0, 0
+	if err := s.save(number); err != nil {
+		return fmt.Errorf("save checkpoint failed: %w", err)
+	}
+	return nil
+}
+
+// traced returns the contracts created by contracts in the block. A failed
+// trace fails the scan, so the block is retried on the next head, up to
+// maxTraceAttempts times.
+func (s *creationScanner) traced(ctx context.Context, block *types.Block) ([]Creation, error) {
+	internal, err := tracedCreations(ctx, s.client, block)
+	if err == nil {
+		return internal, nil
+	}
+	if errors.Is(err, app.ErrRawCallUnsupported) {
+		if !s.traceWarned {
+			s.log.Warnf("only creations by transactions are watched: %s", err)
+			s.traceWarned = true
+		}
+		return nil, nil
+	}
+	s.traceFailures++
+	if s.traceFailures < maxTraceAttempts {
+		return nil, err
+	}
+	s.log.Errorf("creations by contracts in block %d are not watched: %s", block.NumberU64(), err)
+	return nil, nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"plutus/pkg/app"
+)
+
+// creationNode serves blocks, receipts and, if traces is set, block traces.
+type creationNode struct {
+	app.Client
+	blocks   map[uint64]*types.Block
+	receipts map[common.Hash]*types.Receipt
+	// block number -> debug_traceBlockByNumber result
+	traces map[string]string
+}
+
+func (n *creationNode) BlockByNumber(_ context.Context, number *big.Int) (*types.Block, error) {
+	block, ok := n.blocks[number.Uint64()]
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return block, nil
+}
+
+func (n *creationNode) TransactionReceipt(_ context.Context, txHash common.Hash) (*types.Receipt, error) {
+	receipt, ok := n.receipts[txHash]
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return receipt, nil
+}
+
+func (n *creationNode) CallContext(_ context.Context, result any, method string, args ...any) error {
+	if n.traces == nil {
+		return app.ErrRawCallUnsupported
+	}
+	return json.Unmarshal([]byte(n.traces[args[0].(string)]), result)
+}
+
+func creationTx(nonce uint64) *types.Transaction {
+	return types.NewTx(&types.LegacyTx{Nonce: nonce, Data: []byte{0x60, 0x00}})
+}
+
+func newCreationNode() *creationNode {
+	target := common.HexToAddress("0x10")
+	call := types.NewTx(&types.LegacyTx{Nonce: 0, To: &target})
+	created, failed := creationTx(1), creationTx(2)
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(4)}).WithBody([]*types.Transaction{call, created, failed}, nil)
+	return &creationNode{
+		blocks: map[uint64]*types.Block{
+			4: block,
+			5: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(5)}),
+			6: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(6)}).WithBody([]*types.Transaction{creationTx(3)}, nil),
+		},
+		receipts: map[common.Hash]*types.Receipt{
+			created.Hash():       {Status: types.ReceiptStatusSuccessful, ContractAddress: common.HexToAddress("0x01")},
+			failed.Hash():        {Status: types.ReceiptStatusFailed, ContractAddress: common.HexToAddress("0x02")},
+			creationTx(3).Hash(): {Status: types.ReceiptStatusSuccessful, ContractAddress: common.HexToAddress("0x03")},
+		},
+	}
+}
+
+func TestBlockCreations(t *testing.T) {
+	node := newCreationNode()
+	block := node.blocks[4]
+	creations, err := blockCreations(context.Background(), node, block)
+	assert.NoError(t, err)
+	assert.Equal(t, []Creation{{Contract: common.HexToAddress("0x01"), Block: 4, TxHash: block.Transactions()[1].Hash()}}, creations)
+}
+
+func TestTracedCreations(t *testing.T) {
+	node := newCreationNode()
+	block := node.blocks[4]
+	node.traces = map[string]string{hexutil.EncodeUint64(4): `[
+		{"result": {"type": "CALL", "to": "0x0000000000000000000000000000000000000010", "calls": [
+			{"type": "CREATE2", "to": "0x0000000000000000000000000000000000000004", "calls": [{"type": "CREATE", "to": "0x0000000000000000000000000000000000000005"}]},
+			{"type": "CALL", "to": "0x0000000000000000000000000000000000000011", "error": "execution reverted", "calls": [{"type": "CREATE", "to": "0x0000000000000000000000000000000000000006"}]}
+		]}},
+		{"txHash": "0x0000000000000000000000000000000000000000000000000000000000000abc", "result": {"type": "CREATE", "to": "0x0000000000000000000000000000000000000001"}},
+		{"result": {"type": "CREATE", "to": "0x0000000000000000000000000000000000000002", "error": "out of gas", "calls": [{"type": "CREATE", "to": "0x0000000000000000000000000000000000000007"}]}}
+	]`}
+
+	creations, err := tracedCreations(context.Background(), node, block)
+	assert.NoError(t, err)
+	txHash := block.Transactions()[0].Hash()
+	assert.Equal(t, []Creation{
+		{Contract: common.HexToAddress("0x04"), Block: 4, TxHash: txHash, Internal: true},
+		{Contract: common.HexToAddress("0x05"), Block: 4, TxHash: txHash, Internal: true},
+	}, creations)
+
+	node.traces = nil
+	_, err = tracedCreations(context.Background(), node, block)
+	assert.ErrorIs(t, err, app.ErrRawCallUnsupported)
+}
+
+func TestCreationScanner(t *testing.T) {
+	checkpoint := app.NewMemoryCheckpoint()
+	b := &BaseService{
+		Status: &app.Status{Client: newCreationNode(), Checkpoint: checkpoint},
+		log:    logrus.NewEntry(logrus.New()),
+	}
+	var handled []common.Address
+	var failing error
+	scanner := b.newCreationScanner("constructor.creations", 1, func() bool { return true }, func(c Creation) error {
+		if failing != nil {
+			return failing
+		}
+		handled = append(handled, c.Contract)
+		return nil
+	})
+
+	// from the first confirmed block, the trace is not supported
+	assert.NoError(t, scanner.scan(context.Background(), 5))
+	assert.Equal(t, []common.Address{common.HexToAddress("0x01")}, handled)
+	assert.True(t, scanner.traceWarned)
+
+	// the creation of block 6 failed to be handled, retried on the next head
+	failing = errors.New("connection refused")
+	assert.Error(t, scanner.scan(context.Background(), 7))
+	assert.Equal(t, uint64(6), scanner.next)
+	last, _ := checkpoint.Load("constructor.creations")
+	assert.Equal(t, uint64(5), last)
+	failing = nil
+
+	assert.NoError(t, scanner.scan(context.Background(), 7))
+	assert.Equal(t, []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x03")}, handled)
+	last, _ = checkpoint.Load("constructor.creations")
+	assert.Equal(t, uint64(6), last)
+
+	// block 7 is missing, retried on the next head
+	assert.Error(t, scanner.scan(context.Background(), 8))
+	assert.Equal(t, uint64(7), scanner.next)
+
+	// resumed from the checkpoint
+	scanner = b.newCreationScanner("constructor.creations", 1, func() bool { return false }, nil)
+	assert.Equal(t, uint64(7), scanner.next)
+}
+
+func TestCreationScannerCatchUp(t *testing.T) {
+	checkpoint := app.NewMemoryCheckpoint()
+	assert.NoError(t, checkpoint.Save("constructor.creations", 3))
+	node := newCreationNode()
+	// the trace of block 4 fails
+	node.traces = map[string]string{hexutil.EncodeUint64(5): `[]`, hexutil.EncodeUint64(6): `[]`}
+	b := &BaseService{
+		Status: &app.Status{Client: node, Checkpoint: checkpoint},
+		log:    logrus.NewEntry(logrus.New()),
+		cfg:    &app.Config{BackfillRange: 2},
+	}
+	var handled []common.Address
+	scanner := b.newCreationScanner("constructor.creations", 0, func() bool { return true }, func(c Creation) error {
+		handled = append(handled, c.Contract)
+		return nil
+	})
+
+	// the trace of block 4 is retried on the next heads, then given up
+	for i := 1; i < maxTraceAttempts; i++ {
+		assert.Error(t, scanner.scan(context.Background(), 6))
+		assert.Equal(t, uint64(4), scanner.next)
+		assert.Empty(t, handled)
+	}
+	assert.NoError(t, scanner.scan(context.Background(), 6))
+	assert.Equal(t, []common.Address{common.HexToAddress("0x01")}, handled)
+
+	// nothing is skipped catching up, 2 blocks on every head
+	assert.Equal(t, uint64(6), scanner.next)
+	assert.NoError(t, scanner.scan(context.Background(), 6))
+	assert.Equal(t, []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x03")}, handled)
+	last, _ := checkpoint.Load("constructor.creations")
+	assert.Equal(t, uint64(6), last)
+}
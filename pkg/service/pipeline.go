@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"plutus/pkg/app"
+)
+
+// pipeline passes the events of a service through a confirmation queue to
+// handle, follows up reorged out events with retract and keeps the checkpoint.
+// Events are taken once, whichever order they come in, from the backfill or
+// from the subscriptions. Events failed to be handled are retried on the next
+// head, the checkpoint stops before the first of them.
+type pipeline[T any] struct {
+	*progress
+	queue   *app.ConfirmQueue[T]
+	raw     func(T) types.Log
+	handle  func(T) error
+	retract func(T)
+	// log key -> block of the events taken after the last processed block
+	pushed map[app.LogKey]uint64
+	// events failed to be handled, in the order they were handled
+	failed []T
+}
+
+func newPipeline[T any](b *BaseService, name string, raw func(T) types.Log, handle func(T) error, retract func(T)) *pipeline[T] {
+	var srvCfg app.ServiceConfig
+	if b.cfg != nil {
+		srvCfg = b.cfg.Services[name]
+	}
+	if !srvCfg.NotifyRetracted {
+		retract = func(T) {}
+	}
+	return &pipeline[T]{
+		progress: b.newProgress(name, srvCfg.Confirmations),
+		queue:    app.NewConfirmQueue(srvCfg.Confirmations, raw),
+		raw:      raw,
+		handle:   handle,
+		retract:  retract,
+		pushed:   map[app.LogKey]uint64{},
+	}
+}
+
+// watchHeads subscribes new heads, which confirm pending events and advance
+// the checkpoint.
+func (p *pipeline[T]) watchHeads(ctx context.Context, client app.Client, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return client.SubscribeNewHead(ctx, ch)
+}
+
+// push takes an event, skipping the events of processed blocks and the ones
+// taken already.
+func (p *pipeline[T]) push(event T) {
+	log := p.raw(event)
+	key := app.KeyOf(log)
+	if log.Removed {
+		delete(p.pushed, key)
+		p.drop(key)
+	} else {
+		if _, ok := p.pushed[key]; ok || p.processed(log.BlockNumber) {
+			return
+		}
+		p.pushed[key] = log.BlockNumber
+	}
+
+	ready, retracted := p.queue.Push(event)
+	for _, e := range retracted {
+		p.retract(e)
+	}
+	p.handleAll(ready)
+}
+
+// handleAll handles the events, keeping the failed ones to retry.
+func (p *pipeline[T]) handleAll(events []T) {
+	for _, e := range events {
+		if err := p.handle(e); err != nil {
+			p.failed = append(p.failed, e)
+		}
+	}
+	p.hold()
+}
+
+// drop forgets the failed event of the key, reorged out before it was
+// handled.
+func (p *pipeline[T]) drop(key app.LogKey) {
+	failed := p.failed[:0]
+	for _, e := range p.failed {
+		if app.KeyOf(p.raw(e)) != key {
+			failed = append(failed, e)
+		}
+	}
+	p.failed = failed
+	p.hold()
+}
+
+// hold keeps the checkpoint before the first block of the failed events.
+func (p *pipeline[T]) hold() {
+	p.progress.failed = 0
+	for _, e := range p.failed {
+		if block := p.raw(e).BlockNumber; p.progress.failed == 0 || block < p.progress.failed {
+			p.progress.failed = block
+		}
+	}
+}
+
+// pushAll takes the events in the order of their logs in the chain.
+func (p *pipeline[T]) pushAll(events []T) {
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := p.raw(events[i]), p.raw(events[j])
+		if a.BlockNumber != b.BlockNumber {
+			return a.BlockNumber < b.BlockNumber
+		}
+		return a.Index < b.Index
+	})
+	for _, e := range events {
+		p.push(e)
+	}
+}
+
+// confirm retries the failed events, handles the events confirmed at the head
+// and advances the checkpoint.
+func (p *pipeline[T]) confirm(head *types.Header) error {
+	failed := p.failed
+	p.failed = nil
+	p.handleAll(append(failed, p.queue.Confirm(head.Number.Uint64())...))
+	err := p.confirmed(head.Number.Uint64())
+	for key, block := range p.pushed {
+		if p.processed(block) {
+			delete(p.pushed, key)
+		}
+	}
+	return err
+}
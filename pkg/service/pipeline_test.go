@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"plutus/pkg/app"
+)
+
+// headNode serves the head block number.
+type headNode struct {
+	app.Client
+	head uint64
+}
+
+func (n *headNode) BlockNumber(context.Context) (uint64, error) {
+	return n.head, nil
+}
+
+func newPipelineService(head uint64, checkpoint app.Checkpoint, confirmations uint64) *BaseService {
+	return &BaseService{
+		Status: &app.Status{Client: &headNode{head: head}, Checkpoint: checkpoint},
+		log:    logrus.NewEntry(logrus.New()),
+		cfg: &app.Config{
+			BackfillRange: 2,
+			Services:      map[string]app.ServiceConfig{"test": {Confirmations: confirmations, NotifyRetracted: true}},
+		},
+	}
+}
+
+func event(block uint64, index uint) types.Log {
+	return types.Log{
+		BlockNumber: block,
+		BlockHash:   common.BigToHash(new(big.Int).SetUint64(block)),
+		Index:       index,
+	}
+}
+
+func header(block uint64) *types.Header {
+	return &types.Header{Number: new(big.Int).SetUint64(block)}
+}
+
+func newTestPipeline(b *BaseService, handled, retracted *[]types.Log) *pipeline[types.Log] {
+	return newPipeline(b, "test", func(l types.Log) types.Log { return l },
+		func(l types.Log) error {
+			*handled = append(*handled, l)
+			return nil
+		},
+		func(l types.Log) { *retracted = append(*retracted, l) })
+}
+
+func TestPipelineOutOfOrder(t *testing.T) {
+	checkpoint := app.NewMemoryCheckpoint()
+	var handled, retracted []types.Log
+	pipe := newTestPipeline(newPipelineService(10, checkpoint, 0), &handled, &retracted)
+
+	// an event of the next block does not mark the block as done
+	pipe.push(event(11, 0))
+	pipe.push(event(10, 0))
+	pipe.push(event(10, 1))
+	pipe.push(event(10, 1))
+	assert.Equal(t, []types.Log{event(11, 0), event(10, 0), event(10, 1)}, handled)
+	_, ok := checkpoint.Load("test")
+	assert.False(t, ok)
+
+	// events of the head block may still arrive
+	assert.NoError(t, pipe.confirm(header(11)))
+	last, ok := checkpoint.Load("test")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(10), last)
+	pipe.push(event(11, 1))
+	assert.Len(t, handled, 4)
+
+	// late events of done blocks are dropped
+	pipe.push(event(10, 2))
+	assert.Len(t, handled, 4)
+	assert.NoError(t, pipe.confirm(header(12)))
+	assert.Empty(t, pipe.pushed)
+}
+
+func TestPipelinePushAll(t *testing.T) {
+	var handled, retracted []types.Log
+	pipe := newTestPipeline(newPipelineService(10, nil, 0), &handled, &retracted)
+
+	// transfers of one token, then of the other
+	pipe.pushAll([]types.Log{event(11, 3), event(12, 0), event(11, 1), event(12, 2)})
+	assert.Equal(t, []types.Log{event(11, 1), event(11, 3), event(12, 0), event(12, 2)}, handled)
+}
+
+func TestPipelineConfirmations(t *testing.T) {
+	checkpoint := app.NewMemoryCheckpoint()
+	var handled, retracted []types.Log
+	pipe := newTestPipeline(newPipelineService(10, checkpoint, 2), &handled, &retracted)
+
+	pipe.push(event(10, 0))
+	assert.NoError(t, pipe.confirm(header(11)))
+	assert.Empty(t, handled)
+	last, _ := checkpoint.Load("test")
+	assert.Equal(t, uint64(9), last)
+
+	assert.NoError(t, pipe.confirm(header(12)))
+	assert.Equal(t, []types.Log{event(10, 0)}, handled)
+	last, _ = checkpoint.Load("test")
+	assert.Equal(t, uint64(10), last)
+
+	// reorged out after it is handled
+	removed := event(10, 0)
+	removed.Removed = true
+	pipe.push(removed)
+	assert.Equal(t, []types.Log{removed}, retracted)
+}
+
+func TestPipelineFailure(t *testing.T) {
+	checkpoint := app.NewMemoryCheckpoint()
+	b := newPipelineService(10, checkpoint, 0)
+	var handled []types.Log
+	failing := map[uint64]bool{11: true}
+	pipe := newPipeline(b, "test", func(l types.Log) types.Log { return l },
+		func(l types.Log) error {
+			if failing[l.BlockNumber] {
+				return errors.New("connection refused")
+			}
+			handled = append(handled, l)
+			return nil
+		},
+		func(types.Log) {})
+
+	pipe.push(event(10, 0))
+	pipe.push(event(11, 0))
+	pipe.push(event(12, 0))
+	assert.Equal(t, []types.Log{event(10, 0), event(12, 0)}, handled)
+
+	// the checkpoint stops before the failed event
+	assert.NoError(t, pipe.confirm(header(14)))
+	last, _ := checkpoint.Load("test")
+	assert.Equal(t, uint64(10), last)
+	pipe.push(event(11, 0))
+	assert.Len(t, handled, 2)
+
+	// retried on the next head
+	failing = nil
+	assert.NoError(t, pipe.confirm(header(15)))
+	assert.Equal(t, []types.Log{event(10, 0), event(12, 0), event(11, 0)}, handled)
+	last, _ = checkpoint.Load("test")
+	assert.Equal(t, uint64(14), last)
+
+	// reorged out before it is handled
+	failing = map[uint64]bool{16: true}
+	pipe.push(event(16, 0))
+	removed := event(16, 0)
+	removed.Removed = true
+	pipe.push(removed)
+	assert.NoError(t, pipe.confirm(header(18)))
+	assert.Len(t, handled, 3)
+	last, _ = checkpoint.Load("test")
+	assert.Equal(t, uint64(17), last)
+}
+
+func TestPipelineRestart(t *testing.T) {
+	checkpoint := app.NewMemoryCheckpoint()
+	b := newPipelineService(10, checkpoint, 0)
+	var handled, retracted []types.Log
+	pipe := newTestPipeline(b, &handled, &retracted)
+
+	// first run, nothing to backfill
+	assert.NoError(t, b.backfill(context.Background(), pipe.progress, func(*bind.FilterOpts) error {
+		t.Fatal("nothing to backfill")
+		return nil
+	}))
+	last, _ := checkpoint.Load("test")
+	assert.Equal(t, uint64(9), last)
+	pipe.push(event(10, 0))
+	assert.NoError(t, pipe.confirm(header(11)))
+	last, _ = checkpoint.Load("test")
+	assert.Equal(t, uint64(10), last)
+
+	// restarted at block 15, block 11 - 15 are backfilled in chunks
+	b.Client.(*headNode).head = 15
+	handled = nil
+	pipe = newTestPipeline(b, &handled, &retracted)
+	var ranges [][2]uint64
+	assert.NoError(t, b.backfill(context.Background(), pipe.progress, func(opts *bind.FilterOpts) error {
+		ranges = append(ranges, [2]uint64{opts.Start, *opts.End})
+		for block := opts.Start; block <= *opts.End; block++ {
+			pipe.push(event(block, 0))
+		}
+		return nil
+	}))
+	assert.Equal(t, [][2]uint64{{11, 12}, {13, 14}, {15, 15}}, ranges)
+	assert.Equal(t, []types.Log{event(11, 0), event(12, 0), event(13, 0), event(14, 0), event(15, 0)}, handled)
+	last, _ = checkpoint.Load("test")
+	assert.Equal(t, uint64(15), last)
+
+	// events of the backfilled blocks delivered by the subscription again
+	pipe.push(event(15, 0))
+	pipe.push(event(16, 0))
+	assert.Len(t, handled, 6)
+}
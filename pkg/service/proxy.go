@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+
+	"plutus/pkg/app"
+	"plutus/pkg/common/fingerprint"
+)
+
+// Kinds of proxies
+const (
+	ProxyMinimal    = "EIP-1167"
+	ProxyERC1967    = "ERC-1967"
+	ProxyBeacon     = "ERC-1967 beacon"
+	ProxyZeppelinOS = "ZeppelinOS"
+)
+
+// maxProxyDepth bounds the proxies of proxies followed
+const maxProxyDepth = 3
+
+var (
+	// bytes32(uint256(keccak256("eip1967.proxy.implementation")) - 1)
+	implementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	// bytes32(uint256(keccak256("eip1967.proxy.beacon")) - 1)
+	beaconSlot = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50")
+	// keccak256("org.zeppelinos.proxy.implementation"), of the transparent
+	// proxies predating ERC-1967
+	zeppelinOSSlot = common.HexToHash("0x7050c9e0f4ca769c69bd3a8ef740bc37934f8e2c036e5a723fd8ee048ed3f8c3")
+	// implementation() of beacons
+	implementationSelector = common.FromHex("0x5c60da1b")
+)
+
+// Proxy is a contract delegating to its implementation.
+type Proxy struct {
+	Kind           string
+	Implementation common.Address
+}
+
+// slotAddress reads the address stored in the slot, zero if there is none.
+func slotAddress(ctx context.Context, client app.Client, contract common.Address, slot common.Hash) (common.Address, error) {
+	value, err := client.StorageAt(ctx, contract, slot, nil)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("read slot %s of %s failed: %w", slot, contract, err)
+	}
+	return common.BytesToAddress(value), nil
+}
+
+// implementationOf returns the implementation the code of contract delegates
+// to, nil if it is not a proxy.
+func implementationOf(ctx context.Context, client app.Client, contract common.Address, code []byte) (*Proxy, error) {
+	if implementation, ok := fingerprint.MinimalProxy(code); ok {
+		return &Proxy{Kind: ProxyMinimal, Implementation: implementation}, nil
+	}
+	if !fingerprint.Delegates(code) {
+		return nil, nil
+	}
+
+	implementation, err := slotAddress(ctx, client, contract, implementationSlot)
+	if err != nil {
+		return nil, err
+	}
+	if implementation != (common.Address{}) {
+		return &Proxy{Kind: ProxyERC1967, Implementation: implementation}, nil
+	}
+
+	beacon, err := slotAddress(ctx, client, contract, beaconSlot)
+	if err != nil {
+		return nil, err
+	}
+	if beacon != (common.Address{}) {
+		ret, err := client.CallContract(ctx, ethereum.CallMsg{To: &beacon, Data: implementationSelector}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("get implementation of beacon %s failed: %w", beacon, err)
+		}
+		if len(ret) == 32 {
+			return &Proxy{Kind: ProxyBeacon, Implementation: common.BytesToAddress(ret)}, nil
+		}
+	}
+
+	implementation, err = slotAddress(ctx, client, contract, zeppelinOSSlot)
+	if err != nil {
+		return nil, err
+	}
+	if implementation != (common.Address{}) {
+		return &Proxy{Kind: ProxyZeppelinOS, Implementation: implementation}, nil
+	}
+	return nil, nil
+}
+
+// resolveProxy follows the contract with the code to its implementation if
+// it is a proxy, also through proxies of proxies. It returns the proxy, nil
+// if the contract is not one, and the code of the implementation, the code
+// of the contract otherwise.
+func resolveProxy(ctx context.Context, client app.Client, contract common.Address, code []byte) (*Proxy, []byte, error) {
+	var ret *Proxy
+	for depth := 0; depth < maxProxyDepth; depth++ {
+		proxy, err := implementationOf(ctx, client, contract, code)
+		if err != nil {
+			return nil, nil, err
+		}
+		if proxy == nil {
+			break
+		}
+		implementationCode, err := client.CodeAt(ctx, proxy.Implementation, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get code of implementation %s failed: %w", proxy.Implementation, err)
+		}
+		if len(implementationCode) == 0 {
+			break
+		}
+		if ret == nil {
+			ret = &Proxy{Kind: proxy.Kind}
+		}
+		ret.Implementation = proxy.Implementation
+		contract, code = proxy.Implementation, implementationCode
+	}
+	return ret, code, nil
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+
+	"plutus/pkg/app"
+)
+
+// proxyNode serves the code and storage of contracts, and the implementation
+// of beacons.
+type proxyNode struct {
+	app.Client
+	code    map[common.Address][]byte
+	storage map[common.Address]map[common.Hash]common.Address
+	beacons map[common.Address]common.Address
+}
+
+func (n *proxyNode) CodeAt(_ context.Context, contract common.Address, _ *big.Int) ([]byte, error) {
+	return n.code[contract], nil
+}
+
+func (n *proxyNode) StorageAt(_ context.Context, contract common.Address, slot common.Hash, _ *big.Int) ([]byte, error) {
+	return common.LeftPadBytes(n.storage[contract][slot].Bytes(), 32), nil
+}
+
+func (n *proxyNode) CallContract(_ context.Context, call ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	return common.LeftPadBytes(n.beacons[*call.To].Bytes(), 32), nil
+}
+
+func TestResolveProxy(t *testing.T) {
+	var (
+		token          = common.HexToAddress("0x01")
+		implementation = common.HexToAddress("0x02")
+		beacon         = common.HexToAddress("0x03")
+		clone          = common.HexToAddress("0x04")
+		// a contract which delegates
+		proxyCode          = common.FromHex("0x3660008037f400")
+		implementationCode = common.FromHex("0x6001600201")
+	)
+	minimalProxyCode := append(append(common.FromHex("0x363d3d373d3d3d363d73"), token.Bytes()...), common.FromHex("0x5af43d82803e903d91602b57fd5bf3")...)
+
+	node := &proxyNode{
+		code: map[common.Address][]byte{
+			token:          proxyCode,
+			implementation: implementationCode,
+			clone:          minimalProxyCode,
+		},
+		storage: map[common.Address]map[common.Hash]common.Address{},
+		beacons: map[common.Address]common.Address{beacon: implementation},
+	}
+	ctx := context.Background()
+
+	proxy, code, err := resolveProxy(ctx, node, implementation, implementationCode)
+	assert.NoError(t, err)
+	assert.Nil(t, proxy)
+	assert.Equal(t, implementationCode, code)
+
+	// delegates without a known slot
+	proxy, code, err = resolveProxy(ctx, node, token, proxyCode)
+	assert.NoError(t, err)
+	assert.Nil(t, proxy)
+	assert.Equal(t, proxyCode, code)
+
+	for slot, kind := range map[common.Hash]string{
+		implementationSlot: ProxyERC1967,
+		zeppelinOSSlot:     ProxyZeppelinOS,
+	} {
+		node.storage[token] = map[common.Hash]common.Address{slot: implementation}
+		proxy, code, err = resolveProxy(ctx, node, token, proxyCode)
+		assert.NoError(t, err)
+		assert.Equal(t, &Proxy{Kind: kind, Implementation: implementation}, proxy)
+		assert.Equal(t, implementationCode, code)
+	}
+
+	node.storage[token] = map[common.Hash]common.Address{beaconSlot: beacon}
+	proxy, _, err = resolveProxy(ctx, node, token, proxyCode)
+	assert.NoError(t, err)
+	assert.Equal(t, &Proxy{Kind: ProxyBeacon, Implementation: implementation}, proxy)
+
+	// a minimal proxy of the beacon proxy
+	proxy, code, err = resolveProxy(ctx, node, clone, minimalProxyCode)
+	assert.NoError(t, err)
+	assert.Equal(t, &Proxy{Kind: ProxyMinimal, Implementation: implementation}, proxy)
+	assert.Equal(t, implementationCode, code)
+
+	// implementation without code
+	node.storage[token] = map[common.Hash]common.Address{implementationSlot: common.HexToAddress("0x05")}
+	proxy, code, err = resolveProxy(ctx, node, token, proxyCode)
+	assert.NoError(t, err)
+	assert.Nil(t, proxy)
+	assert.Equal(t, proxyCode, code)
+}
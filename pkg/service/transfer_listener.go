@@ -3,10 +3,15 @@ package service
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
 	log "github.com/sirupsen/logrus"
 
 	"plutus/pkg/app"
@@ -36,9 +41,50 @@ var (
 	}
 )
 
+const (
+	transferTemplateZh = `{{if .Retracted}}{{heading "该交易已因区块重组回滚"}}
+
+{{end}}{{heading "Tx Hash"}}
+{{txLink .}}
+
+{{heading "发款方"}}
+{{addressLink . (address . "from")}}
+
+{{heading "收款方"}}
+{{addressLink . (address . "to")}}
+
+{{heading "金额"}}
+{{with amount . "amount"}}{{escape .Value}} {{.Symbol}}{{end}}
+
+{{heading "关联币种"}}
+{{range addresses . "relevant_tokens"}}{{escape "- "}}{{addressLink $ .}}
+{{end}}`
+
+	transferTemplateEn = `{{if .Retracted}}{{heading "The transfer was reorged out of the chain"}}
+
+{{end}}{{heading "Tx Hash"}}
+{{txLink .}}
+
+{{heading "From"}}
+{{addressLink . (address . "from")}}
+
+{{heading "To"}}
+{{addressLink . (address . "to")}}
+
+{{heading "Amount"}}
+{{with amount . "amount"}}{{escape .Value}} {{.Symbol}}{{end}}
+
+{{heading "Relevant Tokens"}}
+{{range addresses . "relevant_tokens"}}{{escape "- "}}{{addressLink $ .}}
+{{end}}`
+)
+
 type TransferListener struct {
 	BaseService
-	srvCfg      *TransferConfig
+	mu     sync.RWMutex
+	srvCfg *TransferConfig
+	// signals Run to resubscribe with the reloaded wallets
+	resubscribe chan struct{}
 	bnb         *book.Erc20
 	usdt        *book.Erc20
 	pancakeSwap *book.PancakeRouterV2
@@ -47,63 +93,123 @@ type TransferListener struct {
 type TransferConfig struct {
 	Wallets        []string `koanf:"wallets"`
 	ThresholdValue string   `koanf:"threshold_value"`
+	// transfers below warning_value are info, at or above critical_value
+	// critical, every transfer is a warning if neither is set
+	WarningValue  string `koanf:"warning_value"`
+	CriticalValue string `koanf:"critical_value"`
 }
 
-type TransferMsg struct {
-	txHash string
-	from   string
-	to     string
-	amount string
-	// type: token address -> token name
-	relevantTokens map[string]string
+// usdt parses a configured value in USDT, zero if empty.
+func usdt(value string) decimal.Decimal {
+	ret, _ := decimal.NewFromString(value)
+	return ret
 }
 
-func (t *TransferMsg) String() string {
-	return fmt.Sprintf("[%s] Received transfer event - Tx Hash: %s, From: %s, To: %s, Value: %s USDT, Relevant Tokens: %v",
-		time.Now().Format("2006-01-02 15:04:05"),
-		t.txHash,
-		t.from,
-		t.to,
-		t.amount,
-		t.relevantTokens,
-	)
-}
-
-func (t *TransferMsg) HumanReadableMsg() string {
-	relevantTokens := strings.Builder{}
-	for addr, name := range t.relevantTokens {
-		relevantTokens.WriteString(fmt.Sprintf("- [%s](https://ave.ai/token/%s-bsc)\n", name, addr))
+// severity grades a transfer by its value in USDT.
+func (c *TransferConfig) severity(value decimal.Decimal) notice.Severity {
+	if c.CriticalValue != "" && !value.LessThan(usdt(c.CriticalValue)) {
+		return notice.SeverityCritical
 	}
+	if c.WarningValue != "" && value.LessThan(usdt(c.WarningValue)) {
+		return notice.SeverityInfo
+	}
+	return notice.SeverityWarning
+}
 
-	tmpl := `
-### Tx Hash
-[%s](https://bscscan.com/tx/%s)
-
-### 发款方
-[%s](https://www.oklink.com/cn/bsc/address/%s)
+func (t *TransferListener) Name() string {
+	return "transfer"
+}
 
-### 收款方
-[%s](https://www.oklink.com/cn/bsc/address/%s)
+// ValidateConfig checks the wallets are addresses and the values decimals.
+func (t *TransferListener) ValidateConfig(v *app.Validator) {
+	var cfg TransferConfig
+	v, ok := app.ValidateServiceConfig(v, t.Name(), &cfg)
+	if !ok {
+		return
+	}
+	if len(cfg.Wallets) == 0 {
+		v.Errorf("wallets", "is required")
+	}
+	for i, wallet := range cfg.Wallets {
+		v.Address(fmt.Sprintf("wallets[%d]", i), wallet)
+	}
+	v.Decimal("threshold_value", cfg.ThresholdValue)
+	v.Decimal("warning_value", cfg.WarningValue)
+	v.Decimal("critical_value", cfg.CriticalValue)
+	if cfg.WarningValue != "" && cfg.CriticalValue != "" && usdt(cfg.CriticalValue).LessThan(usdt(cfg.WarningValue)) {
+		v.Errorf("critical_value", "is below warning_value")
+	}
+}
 
-### 金额
-%s USDT
+// config returns the current config, replaced as a whole on reload.
+func (t *TransferListener) config() *TransferConfig {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.srvCfg
+}
 
-### 关联币种
-%s`
-	return fmt.Sprintf(tmpl,
-		t.txHash, t.txHash, t.from, t.from, t.to, t.to, t.amount, relevantTokens.String())
+// Reload takes the new thresholds right away, and resubscribes if the wallets
+// changed. Transfers missed meanwhile are backfilled from the checkpoint.
+func (t *TransferListener) Reload(config *app.Config) error {
+	srvCfg := &TransferConfig{}
+	if err := app.LoadServiceConfig(t.Name(), srvCfg); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	old := t.srvCfg
+	t.srvCfg = srvCfg
+	t.mu.Unlock()
+
+	added, removed := diffAddresses(old.Wallets, srvCfg.Wallets)
+	t.log.WithField("added wallets", added).
+		WithField("removed wallets", removed).
+		WithField("config", srvCfg).
+		Info("Reloaded")
+	if len(added) > 0 || len(removed) > 0 {
+		select {
+		case t.resubscribe <- struct{}{}:
+		default:
+		}
+	}
+	return nil
 }
 
-func (t *TransferListener) Name() string {
-	return "transfer"
+// diffAddresses returns the addresses only in b and only in a.
+func diffAddresses(a []string, b []string) ([]string, []string) {
+	in := func(list []string, addr string) bool {
+		for _, item := range list {
+			if strings.EqualFold(item, addr) {
+				return true
+			}
+		}
+		return false
+	}
+	var added, removed []string
+	for _, addr := range b {
+		if !in(a, addr) {
+			added = append(added, addr)
+		}
+	}
+	for _, addr := range a {
+		if !in(b, addr) {
+			removed = append(removed, addr)
+		}
+	}
+	return added, removed
 }
 
 func (t *TransferListener) Run(ctx context.Context) error {
 	var wallets []common.Address
-	for _, w := range t.srvCfg.Wallets {
+	for _, w := range t.config().Wallets {
 		wallets = append(wallets, common.HexToAddress(w))
 	}
 
+	pipe := newPipeline(&t.BaseService, t.Name(),
+		func(e *book.Erc20Transfer) types.Log { return e.Raw },
+		func(e *book.Erc20Transfer) error { return t.handleLogged(ctx, e) },
+		func(e *book.Erc20Transfer) { t.retract(e.Raw, t) },
+	)
+
 	bnbSink := make(chan *book.Erc20Transfer)
 	bnbSub, err := t.bnb.WatchTransfer(nil, bnbSink, []common.Address{}, wallets)
 	if err != nil {
@@ -118,15 +224,55 @@ func (t *TransferListener) Run(ctx context.Context) error {
 	}
 	defer usdtSub.Unsubscribe()
 
+	heads := make(chan *types.Header)
+	headSub, err := pipe.watchHeads(ctx, t.Client, heads)
+	if err != nil {
+		return fmt.Errorf("head watch failed: %w", err)
+	}
+	defer headSub.Unsubscribe()
+
+	err = t.backfill(ctx, pipe.progress, func(opts *bind.FilterOpts) error {
+		var events []*book.Erc20Transfer
+		for _, token := range []*book.Erc20{t.bnb, t.usdt} {
+			it, err := token.FilterTransfer(opts, []common.Address{}, wallets)
+			if err != nil {
+				return err
+			}
+			for it.Next() {
+				events = append(events, it.Event)
+			}
+			err = it.Error()
+			_ = it.Close()
+			if err != nil {
+				return err
+			}
+		}
+		// the transfers of both tokens in the order they happened
+		pipe.pushAll(events)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
 	for {
 		var event *book.Erc20Transfer
 		select {
 		case <-ctx.Done():
 			return nil
+		case <-t.resubscribe:
+			t.log.Info("Wallets changed, resubscribing")
+			return nil
 		case err := <-bnbSub.Err():
 			return fmt.Errorf("bnb subscription error: %w", err)
 		case err := <-usdtSub.Err():
 			return fmt.Errorf("usdt subscription error: %w", err)
+		case err := <-headSub.Err():
+			return fmt.Errorf("head subscription error: %w", err)
+		case head := <-heads:
+			if err := pipe.confirm(head); err != nil {
+				t.log.Warnf("save checkpoint failed: %s", err)
+			}
 		case event = <-usdtSink:
 		case event = <-bnbSink:
 		}
@@ -134,13 +280,18 @@ func (t *TransferListener) Run(ctx context.Context) error {
 		if event == nil {
 			continue
 		}
-		err := t.handle(ctx, event)
-		if err != nil {
-			t.log.WithField("tx hash", event.Raw.TxHash).Errorf("handle failed: %s", err)
-		}
+		pipe.push(event)
 	}
 }
 
+func (t *TransferListener) handleLogged(ctx context.Context, event *book.Erc20Transfer) error {
+	err := t.handle(ctx, event)
+	if err != nil {
+		t.log.WithField("tx hash", event.Raw.TxHash).Errorf("handle failed: %s", err)
+	}
+	return err
+}
+
 func (t *TransferListener) handle(ctx context.Context, event *book.Erc20Transfer) error {
 	value := event.Tokens
 	if event.Raw.Address != common.HexToAddress(address.USDT) {
@@ -151,7 +302,7 @@ func (t *TransferListener) handle(ctx context.Context, event *book.Erc20Transfer
 		}
 		value = amountOut
 	}
-	if util.ToDecimal(value, USDTDecimal).LessThan(util.ToDecimal(t.srvCfg.ThresholdValue, 0)) {
+	if util.ToDecimal(value, USDTDecimal).LessThan(usdt(t.config().ThresholdValue)) {
 		return nil
 	}
 
@@ -160,13 +311,35 @@ func (t *TransferListener) handle(ctx context.Context, event *book.Erc20Transfer
 		t.log.WithField("eoa", event.From.Hex()).Warnf("get relevant tokens failed: %s", err)
 		tokens = map[string]string{}
 	}
-	t.BroadCast(&TransferMsg{
-		txHash:         event.Raw.TxHash.Hex(),
-		from:           event.From.Hex(),
-		to:             event.To.Hex(),
-		amount:         util.ToDecimal(value, USDTDecimal).StringFixed(2),
-		relevantTokens: tokens,
-	}, t)
+	amount := util.ToDecimal(value, USDTDecimal).StringFixed(2)
+	alert := &notice.Alert{
+		Service:  t.Name(),
+		Severity: t.config().severity(util.ToDecimal(value, USDTDecimal)),
+		Title:    notice.Labelf("transfer_title", amount),
+		Time:     time.Now(),
+		Chain:    "bsc",
+		Block:    event.Raw.BlockNumber,
+		TxHash:   event.Raw.TxHash.Hex(),
+		Addresses: []notice.Address{
+			{Label: "from", Address: event.From.Hex(), URL: "https://www.oklink.com/cn/bsc/address/" + event.From.Hex()},
+			{Label: "to", Address: event.To.Hex(), URL: "https://www.oklink.com/cn/bsc/address/" + event.To.Hex()},
+		},
+		Amounts: []notice.Amount{{Label: "amount", Value: amount, Symbol: "USDT"}},
+	}
+	addrs := make([]string, 0, len(tokens))
+	for addr := range tokens {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		alert.Addresses = append(alert.Addresses, notice.Address{
+			Label:   "relevant_tokens",
+			Address: addr,
+			Name:    tokens[addr],
+			URL:     fmt.Sprintf("https://ave.ai/token/%s-bsc", addr),
+		})
+	}
+	t.alert(event.Raw, alert, t)
 
 	return nil
 }
@@ -202,23 +375,6 @@ func (t *TransferListener) relevantTokens(ctx context.Context, eoa common.Addres
 	return ret, nil
 }
 
-func (t *TransferListener) DingtalkMsg(msg notice.Msg) (token string, content string) {
-	transferMsg := msg.(*TransferMsg)
-	json := `{
-	  "msgtype": "markdown",
-	  "markdown": {
-		"title": "交易捕获: %s USDT",
-		"text": "%s"
-	  },
-	  "at": {
-		"atMobiles": [],
-		"atUserIds": [],
-		"isAtAll": false
-	  }
-	}`
-	return t.cfg.DingtalkToken, fmt.Sprintf(json, transferMsg.amount, transferMsg.HumanReadableMsg())
-}
-
 func (t *TransferListener) Init(config *app.Config, status *app.Status, log *log.Entry) error {
 	t.cfg = config
 	t.Status = status
@@ -252,9 +408,28 @@ func (t *TransferListener) Init(config *app.Config, status *app.Status, log *log
 }
 
 func NewTransferListener() *TransferListener {
-	return &TransferListener{}
+	return &TransferListener{
+		srvCfg:      &TransferConfig{},
+		resubscribe: make(chan struct{}, 1),
+	}
 }
 
 func init() {
 	app.RegisterService(NewTransferListener())
+	notice.RegisterTemplate("transfer", notice.LanguageZh, transferTemplateZh)
+	notice.RegisterTemplate("transfer", notice.LanguageEn, transferTemplateEn)
+	notice.RegisterLabels(notice.LanguageZh, map[string]string{
+		"transfer_title":  "交易捕获: %s USDT",
+		"from":            "发款方",
+		"to":              "收款方",
+		"amount":          "金额",
+		"relevant_tokens": "关联币种",
+	})
+	notice.RegisterLabels(notice.LanguageEn, map[string]string{
+		"transfer_title":  "Transfer captured: %s USDT",
+		"from":            "From",
+		"to":              "To",
+		"amount":          "Amount",
+		"relevant_tokens": "Relevant Tokens",
+	})
 }
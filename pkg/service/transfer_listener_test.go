@@ -4,9 +4,12 @@ import (
 	"testing"
 
 	"plutus/pkg/app"
+	"plutus/pkg/notice"
 
 	"github.com/nanmu42/etherscan-api"
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -14,6 +17,14 @@ func TestTransferListener(t *testing.T) {
 	suite.Run(t, new(TransferListenerTestSuite))
 }
 
+func TestTransferSeverity(t *testing.T) {
+	cfg := &TransferConfig{WarningValue: "10000", CriticalValue: "100000"}
+	assert.Equal(t, notice.SeverityInfo, cfg.severity(decimal.RequireFromString("9999.99")))
+	assert.Equal(t, notice.SeverityWarning, cfg.severity(decimal.RequireFromString("10000")))
+	assert.Equal(t, notice.SeverityCritical, cfg.severity(decimal.RequireFromString("100000")))
+	assert.Equal(t, notice.SeverityWarning, (&TransferConfig{}).severity(decimal.RequireFromString("1")))
+}
+
 type TransferListenerTestSuite struct {
 	baseTestSuite
 
@@ -37,31 +48,28 @@ func (s *TransferListenerTestSuite) SetupTest() {
 }
 
 func (s *TransferListenerTestSuite) TestHandle() {
-	s.patch.ApplyMethodFunc(s.bscscanClient, "ERC20Transfers",
-		func(contractAddress, address *string, _, _ *int, _, _ int, _ bool) ([]etherscan.ERC20Transfer, error) {
-			s.Nil(contractAddress)
-			s.Equal("0x7A4B173e6Af66cD7a4312a7AE900222f591F403D", *address)
-			return []etherscan.ERC20Transfer{
-				{
-					TokenSymbol: "BUSDT",
-				}, {
-					TokenSymbol:     "TEST",
-					ContractAddress: "0x9624393cba121b81695b6c3d8ffc9337fe581897",
-				}, {
-					ContractAddress: "0xfdcca677e59c138fda21055057f57c3f9adf7656",
-					TokenSymbol:     "UЅDТ",
-				},
-			}, nil
-		})
+	s.transfers = []etherscan.ERC20Transfer{
+		{
+			TokenSymbol: "BUSDT",
+		}, {
+			TokenSymbol:     "TEST",
+			ContractAddress: "0x9624393cba121b81695b6c3d8ffc9337fe581897",
+		}, {
+			ContractAddress: "0xfdcca677e59c138fda21055057f57c3f9adf7656",
+			TokenSymbol:     "UЅDТ",
+		},
+	}
 	s.ReplayBlockWithRun(36094489)
+	s.Equal("0x7A4B173e6Af66cD7a4312a7AE900222f591F403D", s.transfersOf)
 
 	s.NotNil(s.noticeMsg)
-	transferMsg := s.noticeMsg.(*TransferMsg)
-	s.Equal("0x50c647dcb6f7d9e724f342ff5ddc8047f90caee74ca4d083c2b86dbcf4911ade", transferMsg.txHash)
-	s.Equal("0x7A4B173e6Af66cD7a4312a7AE900222f591F403D", transferMsg.from)
-	s.Equal(s.wallets[0], transferMsg.to)
-	s.Equal("6300.00", transferMsg.amount)
-	s.Equal(map[string]string{
-		"0x9624393cba121b81695b6c3d8ffc9337fe581897": "TEST",
-	}, transferMsg.relevantTokens)
+	alert := s.noticeMsg.(*notice.Alert)
+	s.Equal("transfer", alert.Service)
+	s.Equal("0x50c647dcb6f7d9e724f342ff5ddc8047f90caee74ca4d083c2b86dbcf4911ade", alert.TxHash)
+	s.Equal("0x7A4B173e6Af66cD7a4312a7AE900222f591F403D", alert.Addresses[0].Address)
+	s.Equal(s.wallets[0], alert.Addresses[1].Address)
+	s.Equal([]notice.Amount{{Label: "amount", Value: "6300.00", Symbol: "USDT"}}, alert.Amounts)
+	s.Len(alert.Addresses, 3)
+	s.Equal("0x9624393cba121b81695b6c3d8ffc9337fe581897", alert.Addresses[2].Address)
+	s.Equal("TEST", alert.Addresses[2].Name)
 }